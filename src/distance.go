@@ -0,0 +1,262 @@
+package mesh
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// DistanceField samples the signed distance to a mesh's surface at the centers
+// of a regular grid of voxels: negative inside the mesh, positive outside.
+// Voxel (x, y, z) covers the cube whose lower corner is
+// Origin + (x, y, z)·VoxelSize.
+type DistanceField struct {
+	SizeX, SizeY, SizeZ int
+	VoxelSize           float64
+	Origin              vec3.T
+	Distances           []float64 // Indexed by x + SizeX*(y + SizeY*z)
+}
+
+const (
+	// Empty voxels around the mesh, so the zero level set never touches the
+	// edge of the field
+	sdfPadding = 2
+
+	// Octree depth limit; nodes only split when they fill up, so sparse
+	// regions stay shallow
+	sdfOctreeLevels = 12
+)
+
+var (
+	ErrResolution  = errors.New("Voxel size must be positive and finite")
+	ErrNoTriangles = errors.New("The mesh has no triangles")
+)
+
+// ComputeSDF samples the signed distance field of the mesh with the given
+// voxel size, in model units. Distances come from closest point queries
+// against an Octree. Signs come from the winding number along vertical rays,
+// so overlapping shells still count as inside.
+func ComputeSDF(mesh Mesh, voxelSize float64) (*DistanceField, error) {
+	if !(voxelSize > 0) || math.IsInf(voxelSize, 1) {
+		return nil, ErrResolution
+	}
+
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	if len(abuf) == 0 {
+		return nil, ErrNoTriangles
+	}
+
+	bounds := BoxTriangles(abuf...)
+	field := &DistanceField{VoxelSize: voxelSize}
+	var sizes [3]int
+	for i := 0; i < 3; i++ {
+		field.Origin[i] = bounds.LowerBound[i] - sdfPadding*voxelSize
+		extent := bounds.UpperBound[i] - bounds.LowerBound[i]
+		sizes[i] = int(math.Ceil(extent/voxelSize)) + 2*sdfPadding
+	}
+	field.SizeX, field.SizeY, field.SizeZ = sizes[0], sizes[1], sizes[2]
+	field.Distances = make([]float64, field.SizeX*field.SizeY*field.SizeZ)
+
+	tree := NewOctree(sdfOctreeLevels, BoxTriangles(abuf...).ExpandToCube())
+	for _, tri := range abuf {
+		tree.Insert(NewBoxedTriangle(tri))
+	}
+
+	windings := field.windingNumbers(abuf)
+
+	// Queries are independent, so split the field into z layers
+	var wg sync.WaitGroup
+	layers := make(chan int, field.SizeZ)
+	for z := 0; z < field.SizeZ; z++ {
+		layers <- z
+	}
+	close(layers)
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for z := range layers {
+				for y := 0; y < field.SizeY; y++ {
+					for x := 0; x < field.SizeX; x++ {
+						center := field.Center(x, y, z)
+						closest, _ := tree.Nearest(center)
+						dist := vec3.Distance(&center, &closest)
+
+						index := field.index(x, y, z)
+						if windings[index] != 0 {
+							dist = -dist
+						}
+						field.Distances[index] = dist
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return field, nil
+}
+
+func (this *DistanceField) index(x, y, z int) int {
+	return x + this.SizeX*(y+this.SizeY*z)
+}
+
+// At returns the distance at the center of a voxel, clamping to the field.
+func (this *DistanceField) At(x, y, z int) float64 {
+	x = clampInt(x, 0, this.SizeX-1)
+	y = clampInt(y, 0, this.SizeY-1)
+	z = clampInt(z, 0, this.SizeZ-1)
+	return this.Distances[this.index(x, y, z)]
+}
+
+// Center returns the center of a voxel in model coordinates.
+func (this *DistanceField) Center(x, y, z int) vec3.T {
+	return vec3.T{
+		this.Origin[0] + (float64(x)+0.5)*this.VoxelSize,
+		this.Origin[1] + (float64(y)+0.5)*this.VoxelSize,
+		this.Origin[2] + (float64(z)+0.5)*this.VoxelSize,
+	}
+}
+
+// Sample trilinearly interpolates the distance at any point. Points outside
+// the field take the value at its edge.
+func (this *DistanceField) Sample(pt vec3.T) float64 {
+	var cell [3]int
+	var frac [3]float64
+	for i := 0; i < 3; i++ {
+		f := (pt[i]-this.Origin[i])/this.VoxelSize - 0.5
+		floor := math.Floor(f)
+		cell[i] = int(floor)
+		frac[i] = f - floor
+	}
+
+	var result float64
+	for corner := 0; corner < 8; corner++ {
+		weight := 1.0
+		var offset [3]int
+		for i := 0; i < 3; i++ {
+			if corner&(1<<uint(i)) != 0 {
+				offset[i] = 1
+				weight *= frac[i]
+			} else {
+				weight *= 1 - frac[i]
+			}
+		}
+		result += weight * this.At(cell[0]+offset[0], cell[1]+offset[1], cell[2]+offset[2])
+	}
+
+	return result
+}
+
+type rayCrossing struct {
+	z       float64
+	winding int
+}
+
+// Nudges ray positions off the exact voxel centers, where they would
+// otherwise often hit shared triangle edges and be counted twice or not at all
+const rayJitter = 1.234567e-7
+
+// windingNumbers returns the winding number of the mesh around every voxel
+// center, counted along a ray cast straight up from it.
+func (this *DistanceField) windingNumbers(abuf ArrayBuffer) []int {
+	columns := make([][]rayCrossing, this.SizeX*this.SizeY)
+
+	for _, tri := range abuf {
+		// Faces pointing up are where a ray leaves the solid
+		normalZ := doubledAreaZ(tri)
+		if normalZ == 0 {
+			continue
+		}
+		winding := 1
+		if normalZ < 0 {
+			winding = -1
+		}
+
+		box := BoxTriangle(tri)
+		x0, x1 := this.columnRange(box.LowerBound[0], box.UpperBound[0], 0)
+		y0, y1 := this.columnRange(box.LowerBound[1], box.UpperBound[1], 1)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				center := this.Center(x, y, 0)
+				center[0] += rayJitter * this.VoxelSize
+				center[1] += 2 * rayJitter * this.VoxelSize
+
+				z, hit := rayHeight(tri, center[0], center[1], normalZ)
+				if hit {
+					column := &columns[x+this.SizeX*y]
+					*column = append(*column, rayCrossing{z, winding})
+				}
+			}
+		}
+	}
+
+	windings := make([]int, len(this.Distances))
+	for i, column := range columns {
+		x, y := i%this.SizeX, i/this.SizeX
+
+		// Walk down from the top, adding up the crossings above each voxel
+		sort.Slice(column, func(a, b int) bool {
+			return column[a].z > column[b].z
+		})
+
+		var winding, next int
+		for z := this.SizeZ - 1; z >= 0; z-- {
+			height := this.Center(x, y, z)[2]
+			for next < len(column) && column[next].z > height {
+				winding += column[next].winding
+				next++
+			}
+			windings[this.index(x, y, z)] = winding
+		}
+	}
+
+	return windings
+}
+
+// columnRange returns the voxel columns whose centers lie between lower and
+// upper along an axis.
+func (this *DistanceField) columnRange(lower, upper float64, axis int) (int, int) {
+	first := int(math.Ceil((lower-this.Origin[axis])/this.VoxelSize - 0.5))
+	last := int(math.Floor((upper-this.Origin[axis])/this.VoxelSize - 0.5))
+	sizes := [3]int{this.SizeX, this.SizeY, this.SizeZ}
+	return clampInt(first, 0, sizes[axis]-1), clampInt(last, 0, sizes[axis]-1)
+}
+
+// rayHeight returns where the vertical line through (x, y) crosses the
+// triangle, whose doubled projected area is normalZ.
+func rayHeight(tri Triangle, x, y, normalZ float64) (z float64, hit bool) {
+	var weights [3]float64
+	for i := 0; i < 3; i++ {
+		a, b := tri[(i+1)%3], tri[(i+2)%3]
+		weights[i] = ((b[0]-a[0])*(y-a[1]) - (b[1]-a[1])*(x-a[0])) / normalZ
+		if weights[i] < 0 {
+			return 0, false
+		}
+	}
+
+	return weights[0]*tri[0][2] + weights[1]*tri[1][2] + weights[2]*tri[2][2], true
+}
+
+// doubledAreaZ returns twice the area of the triangle projected onto the xy
+// plane, negative if it faces down.
+func doubledAreaZ(tri Triangle) float64 {
+	edge1, edge2 := vec3.Sub(&tri[1], &tri[0]), vec3.Sub(&tri[2], &tri[0])
+	return edge1[0]*edge2[1] - edge1[1]*edge2[0]
+}
+
+func clampInt(val, low, high int) int {
+	if val < low {
+		return low
+	}
+	if val > high {
+		return high
+	}
+	return val
+}
@@ -0,0 +1,67 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestClosestPoint(t *testing.T) {
+	tri := Triangle{
+		vec3.T{0, 0, 0},
+		vec3.T{4, 0, 0},
+		vec3.T{0, 4, 0},
+	}
+
+	cases := map[vec3.T]vec3.T{
+		{1, 1, 5}:   {1, 1, 0}, // Face
+		{-2, -3, 0}: {0, 0, 0}, // Vertex
+		{2, -3, 1}:  {2, 0, 0}, // Edge
+		{3, 3, 0}:   {2, 2, 0}, // Hypotenuse
+	}
+
+	for pt, expected := range cases {
+		if closest := tri.ClosestPoint(pt); vec3.Distance(&closest, &expected) > 1e-12 {
+			t.Fatalf("Closest point to %v should be %v, got %v", pt, expected, closest)
+		}
+	}
+}
+
+func TestComputeSDF(t *testing.T) {
+	abuf := newBoxMesh(vec3.T{0, 0, 0}, vec3.T{10, 10, 10})
+
+	// An overlapping second shell shouldn't flip anything back to outside
+	abuf = append(abuf, newBoxMesh(vec3.T{5, 5, 5}, vec3.T{15, 15, 15})...)
+
+	field, err := ComputeSDF(&abuf, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field.SizeX != 34 {
+		t.Fatalf("Expected a field 34 voxels wide, got %d", field.SizeX)
+	}
+
+	cases := map[vec3.T]float64{
+		{2.25, 4.75, 4.75}:    -2.25, // Inside the first box
+		{7.25, 7.25, 7.25}:    -2.25, // Inside both boxes
+		{-0.75, 4.75, 4.75}:   0.75,  // Just outside
+		{13.75, 2.25, 2.25}:   3.75,  // Closer to the first box than the second
+		{14.25, 14.25, 14.25}: -0.75,
+	}
+
+	for pt, expected := range cases {
+		if dist := field.Sample(pt); math.Abs(dist-expected) > 1e-9 {
+			t.Fatalf("Distance at %v should be %v, got %v", pt, expected, dist)
+		}
+	}
+
+	if _, err := ComputeSDF(&ArrayBuffer{}, 0.5); err != ErrNoTriangles {
+		t.Fatalf("Expected ErrNoTriangles, got %v", err)
+	}
+	for _, voxelSize := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := ComputeSDF(&abuf, voxelSize); err != ErrResolution {
+			t.Fatalf("Voxel size %v: expected ErrResolution, got %v", voxelSize, err)
+		}
+	}
+}
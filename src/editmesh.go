@@ -0,0 +1,309 @@
+package mesh
+
+import "github.com/ungerik/go3d/float64/vec3"
+
+// editMesh is an indexed mesh that can have its edges collapsed, split and
+// flipped. Faces and vertices taken out are only marked, and their indices
+// stay valid.
+type editMesh struct {
+	verts     []vec3.T
+	faces     []Face
+	live      []bool  // Per face
+	around    [][]int // Faces around each vertex
+	merged    []bool  // Vertices collapsed into others
+	boundary  []bool  // Vertices on open edges
+	liveFaces int
+}
+
+func newEditMesh(ibuf *IndexBuffer) *editMesh {
+	count := len(ibuf.Vertices)
+	this := &editMesh{
+		verts:     append([]vec3.T{}, ibuf.Vertices...),
+		faces:     append([]Face{}, ibuf.Faces...),
+		live:      make([]bool, len(ibuf.Faces)),
+		around:    make([][]int, count),
+		merged:    make([]bool, count),
+		boundary:  make([]bool, count),
+		liveFaces: len(ibuf.Faces),
+	}
+
+	edges := make(map[[2]uint32]int)
+	for i, face := range this.faces {
+		this.live[i] = true
+		for j, vert := range face {
+			this.around[vert] = append(this.around[vert], i)
+			edges[edgeKey(vert, face[(j+1)%3])]++
+		}
+	}
+	for edge, count := range edges {
+		if count == 1 {
+			this.boundary[edge[0]], this.boundary[edge[1]] = true, true
+		}
+	}
+	return this
+}
+
+func (this *editMesh) triangle(face Face) Triangle {
+	return Triangle{this.verts[face[0]], this.verts[face[1]], this.verts[face[2]]}
+}
+
+func (this *editMesh) faceHas(face, vert int) bool {
+	for _, other := range this.faces[face] {
+		if int(other) == vert {
+			return true
+		}
+	}
+	return false
+}
+
+// edgeFaces returns the faces on either side of an edge.
+func (this *editMesh) edgeFaces(a, b int) []int {
+	result := make([]int, 0, 2)
+	for _, i := range this.around[a] {
+		if this.faceHas(i, b) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func (this *editMesh) neighbors(vert int) []int {
+	result := make([]int, 0, 8)
+	for _, i := range this.around[vert] {
+		for _, other := range this.faces[i] {
+			if int(other) == vert {
+				continue
+			}
+			known := false
+			for _, seen := range result {
+				if seen == int(other) {
+					known = true
+				}
+			}
+			if !known {
+				result = append(result, int(other))
+			}
+		}
+	}
+	return result
+}
+
+// edges returns each edge of the live faces once.
+func (this *editMesh) edges() [][2]int {
+	result := make([][2]int, 0, this.liveFaces*3/2)
+	for i, face := range this.faces {
+		if !this.live[i] {
+			continue
+		}
+		for j, vert := range face {
+			next := face[(j+1)%3]
+			// Open edges have no twin to list them from the other end
+			if vert < next || len(this.edgeFaces(int(vert), int(next))) == 1 {
+				result = append(result, [2]int{int(vert), int(next)})
+			}
+		}
+	}
+	return result
+}
+
+// canCollapse checks that merging from into to at target keeps the surface a
+// manifold and turns no face over.
+func (this *editMesh) canCollapse(from, to int, target vec3.T) bool {
+	shared := len(this.edgeFaces(from, to))
+	if shared == 0 {
+		return false
+	}
+
+	// The ends may only share the neighbors across the faces they share
+	common := 0
+	toNeighbors := this.neighbors(to)
+	for _, vert := range this.neighbors(from) {
+		for _, other := range toNeighbors {
+			if vert == other {
+				common++
+			}
+		}
+	}
+	if common != shared {
+		return false
+	}
+
+	// Interior edges joining two open edges would pinch the surface
+	if shared == 2 && this.boundary[from] && this.boundary[to] {
+		return false
+	}
+
+	for _, end := range []int{from, to} {
+		for _, i := range this.around[end] {
+			if this.faceHas(i, from) && this.faceHas(i, to) {
+				continue
+			}
+			if !this.keepsFacing(i, end, target) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// keepsFacing checks that moving a vertex of the face to target leaves it
+// facing about the same way.
+func (this *editMesh) keepsFacing(face, vert int, target vec3.T) bool {
+	before := this.triangle(this.faces[face])
+	after := before
+	for j, other := range this.faces[face] {
+		if int(other) == vert {
+			after[j] = target
+		}
+	}
+	oldNormal, newNormal := before.Normal(), after.Normal()
+	return newNormal != (vec3.T{}) && vec3.Dot(&oldNormal, &newNormal) >= 0.2
+}
+
+// collapse merges from into to, moving it to target.
+func (this *editMesh) collapse(from, to int, target vec3.T) {
+	this.verts[to] = target
+	this.boundary[to] = this.boundary[to] || this.boundary[from]
+	this.merged[from] = true
+
+	for _, i := range this.edgeFaces(to, from) {
+		this.live[i] = false
+		this.liveFaces--
+		for _, vert := range this.faces[i] {
+			this.around[vert] = removeInt(this.around[vert], i)
+		}
+	}
+	for _, i := range this.around[from] {
+		for j, vert := range this.faces[i] {
+			if int(vert) == from {
+				this.faces[i][j] = uint32(to)
+			}
+		}
+		this.around[to] = append(this.around[to], i)
+	}
+	this.around[from] = nil
+}
+
+// third returns the vertex of the face after the directed edge from a to b,
+// if the face has that edge.
+func (this *editMesh) third(face, a, b int) (int, bool) {
+	verts := this.faces[face]
+	for j := range verts {
+		if int(verts[j]) == a && int(verts[(j+1)%3]) == b {
+			return int(verts[(j+2)%3]), true
+		}
+	}
+	return 0, false
+}
+
+// split puts a new vertex at pt on the edge between a and b, splitting the
+// faces on either side in two, and returns it.
+func (this *editMesh) split(a, b int, pt vec3.T) int {
+	middle := len(this.verts)
+	faces := this.edgeFaces(a, b)
+	this.verts = append(this.verts, pt)
+	this.around = append(this.around, nil)
+	this.merged = append(this.merged, false)
+	this.boundary = append(this.boundary, len(faces) == 1)
+
+	for _, i := range faces {
+		from, to := a, b
+		opposite, ok := this.third(i, from, to)
+		if !ok {
+			from, to = b, a
+			opposite, _ = this.third(i, from, to)
+		}
+
+		// from, to, opposite becomes from, middle, opposite and middle, to,
+		// opposite
+		for j, vert := range this.faces[i] {
+			if int(vert) == to {
+				this.faces[i][j] = uint32(middle)
+			}
+		}
+		added := len(this.faces)
+		this.faces = append(this.faces, Face{uint32(middle), uint32(to), uint32(opposite)})
+		this.live = append(this.live, true)
+		this.liveFaces++
+
+		this.around[to] = append(removeInt(this.around[to], i), added)
+		this.around[middle] = append(this.around[middle], i, added)
+		this.around[opposite] = append(this.around[opposite], added)
+	}
+	return middle
+}
+
+// flip swaps the edge between a and b for the one joining the vertices
+// across it. It returns false, changing nothing, if the edge isn't between
+// two faces, the other edge is there already, or a face would turn over.
+func (this *editMesh) flip(a, b int) bool {
+	faces := this.edgeFaces(a, b)
+	if len(faces) != 2 {
+		return false
+	}
+	first, second := faces[0], faces[1]
+	c, ok := this.third(first, a, b)
+	if !ok {
+		first, second = second, first
+		if c, ok = this.third(first, a, b); !ok {
+			return false
+		}
+	}
+	d, ok := this.third(second, b, a)
+	if !ok || c == d || len(this.edgeFaces(c, d)) > 0 {
+		return false
+	}
+
+	// a, b, c and b, a, d become a, d, c and d, b, c
+	oldFirst, oldSecond := this.triangle(this.faces[first]), this.triangle(this.faces[second])
+	newFirst := Triangle{this.verts[a], this.verts[d], this.verts[c]}
+	newSecond := Triangle{this.verts[d], this.verts[b], this.verts[c]}
+	firstNormal, secondNormal := oldFirst.Plane().Normal, oldSecond.Plane().Normal
+	oldNormal := vec3.Add(&firstNormal, &secondNormal)
+	oldNormal.Normalize()
+	for _, tri := range []Triangle{newFirst, newSecond} {
+		normal := tri.Normal()
+		if normal == (vec3.T{}) || vec3.Dot(&normal, &oldNormal) < 0.2 {
+			return false
+		}
+	}
+
+	this.faces[first] = Face{uint32(a), uint32(d), uint32(c)}
+	this.faces[second] = Face{uint32(d), uint32(b), uint32(c)}
+	this.around[a] = removeInt(this.around[a], second)
+	this.around[b] = removeInt(this.around[b], first)
+	this.around[c] = append(this.around[c], second)
+	this.around[d] = append(this.around[d], first)
+	return true
+}
+
+func removeInt(list []int, val int) []int {
+	for i, other := range list {
+		if other == val {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// result gathers the faces left, numbering only the vertices they use.
+func (this *editMesh) result() *IndexBuffer {
+	result := &IndexBuffer{Vertices: make([]vec3.T, 0), Faces: make([]Face, 0, this.liveFaces)}
+	indices := make(map[uint32]uint32)
+	for i, face := range this.faces {
+		if !this.live[i] {
+			continue
+		}
+		for j, vert := range face {
+			index, exists := indices[vert]
+			if !exists {
+				index = uint32(len(result.Vertices))
+				indices[vert] = index
+				result.Vertices = append(result.Vertices, this.verts[vert])
+			}
+			face[j] = index
+		}
+		result.Faces = append(result.Faces, face)
+	}
+	return result
+}
@@ -64,6 +64,31 @@ func (this Triangle) Plane() Plane {
 	return Plane{normal, offset}
 }
 
+// Normal returns the unit normal of the triangle, facing the side from which
+// its vertices run counter-clockwise. Degenerate triangles have a zero normal.
+func (this Triangle) Normal() vec3.T {
+	normal := this.Plane().Normal
+	if length := normal.Length(); length > 0 {
+		normal.Scale(1 / length)
+	}
+	return normal
+}
+
+func (this Triangle) Area() float64 {
+	ab := vec3.Sub(&this[1], &this[0])
+	ac := vec3.Sub(&this[2], &this[0])
+	cross := vec3.Cross(&ab, &ac)
+	return cross.Length() / 2
+}
+
+func (this Triangle) Centroid() vec3.T {
+	return vec3.T{
+		(this[0][0] + this[1][0] + this[2][0]) / 3,
+		(this[0][1] + this[1][1] + this[2][1]) / 3,
+		(this[0][2] + this[1][2] + this[2][2]) / 3,
+	}
+}
+
 var (
 	ErrDontIntersect = errors.New("No intersection found")
 	ErrCoplanar      = errors.New("The triangles are coplanar")
@@ -84,6 +109,59 @@ func (this Triangle) ContainsPoint(pt vec3.T) bool {
 		Line{this[1], this[2]}.SameSide(this[0], pt))
 }
 
+// ClosestPoint returns the point of the triangle closest to pt, from
+// Real-Time Collision Detection by Christer Ericson, section 5.1.5.
+func (this Triangle) ClosestPoint(pt vec3.T) vec3.T {
+	a, b, c := this[0], this[1], this[2]
+	ab := vec3.Sub(&b, &a)
+	ac := vec3.Sub(&c, &a)
+
+	// Vertex region outside a
+	ap := vec3.Sub(&pt, &a)
+	d1, d2 := vec3.Dot(&ab, &ap), vec3.Dot(&ac, &ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a
+	}
+
+	// Vertex region outside b
+	bp := vec3.Sub(&pt, &b)
+	d3, d4 := vec3.Dot(&ab, &bp), vec3.Dot(&ac, &bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b
+	}
+
+	// Edge region of ab
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return vec3.Interpolate(&a, &b, d1/(d1-d3))
+	}
+
+	// Vertex region outside c
+	cp := vec3.Sub(&pt, &c)
+	d5, d6 := vec3.Dot(&ab, &cp), vec3.Dot(&ac, &cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c
+	}
+
+	// Edge region of ac
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return vec3.Interpolate(&a, &c, d2/(d2-d6))
+	}
+
+	// Edge region of bc
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		return vec3.Interpolate(&b, &c, (d4-d3)/((d4-d3)+(d5-d6)))
+	}
+
+	// Inside the face
+	denom := 1 / (va + vb + vc)
+	ab.Scale(vb * denom)
+	ac.Scale(vc * denom)
+	return vec3.T{a[0] + ab[0] + ac[0], a[1] + ab[1] + ac[1], a[2] + ab[2] + ac[2]}
+}
+
 type Line [2]vec3.T
 
 func (this Line) SameSide(p0, p1 vec3.T) bool {
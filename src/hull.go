@@ -0,0 +1,319 @@
+package mesh
+
+import (
+	"errors"
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+var ErrFlatHull = errors.New("The points don't span a volume")
+
+// ConvexHull returns the convex hull of the vertices of the mesh.
+func ConvexHull(mesh Mesh) (*IndexBuffer, error) {
+	points := make([]vec3.T, 0, mesh.NumTriangles()*3)
+	for tri := range mesh.read() {
+		points = append(points, tri[:]...)
+	}
+	return ConvexHullPoints(points)
+}
+
+// ConvexHullPoints returns the convex hull of the points by quickhull, with
+// its triangles facing outwards. Only corners of the hull become vertices:
+// duplicates, and points on its flat sides or straight edges, are left out,
+// so flat sides may be split into triangles in any way. Points all on one
+// plane have no hull and give ErrFlatHull.
+func ConvexHullPoints(points []vec3.T) (*IndexBuffer, error) {
+	hull, err := quickhull(points)
+	if err != nil {
+		return nil, err
+	}
+
+	// Points on a side can become vertices before the corners around them
+	// are found, so build the hull again without them
+	if corners := hullCorners(hull); len(corners) < len(hull.Vertices) {
+		return quickhull(corners)
+	}
+	return hull, nil
+}
+
+func quickhull(points []vec3.T) (*IndexBuffer, error) {
+	unique := make([]vec3.T, 0, len(points))
+	seen := make(map[vec3.T]bool, len(points))
+	var scale float64
+	for _, pt := range points {
+		if !seen[pt] {
+			seen[pt] = true
+			unique = append(unique, pt)
+			for _, coord := range pt {
+				scale = math.Max(scale, math.Abs(coord))
+			}
+		}
+	}
+
+	hull := &hullBuilder{
+		points:    unique,
+		edges:     make(map[[2]int]int),
+		tolerance: 1e-10 * math.Max(scale, 1),
+	}
+	if err := hull.start(); err != nil {
+		return nil, err
+	}
+	for hull.grow() {
+	}
+	return hull.result(), nil
+}
+
+// hullCorners returns the vertices of the hull whose faces lie in three
+// planes or more.
+func hullCorners(hull *IndexBuffer) []vec3.T {
+	planes := make([][]vec3.T, len(hull.Vertices))
+	for _, face := range hull.Faces {
+		normal := Triangle{hull.Vertices[face[0]], hull.Vertices[face[1]], hull.Vertices[face[2]]}.Normal()
+		for _, vert := range face {
+			known := false
+			for _, other := range planes[vert] {
+				if vec3.Dot(&normal, &other) > 1-1e-9 {
+					known = true
+				}
+			}
+			if !known {
+				planes[vert] = append(planes[vert], normal)
+			}
+		}
+	}
+
+	result := make([]vec3.T, 0, len(hull.Vertices))
+	for i, vert := range hull.Vertices {
+		if len(planes[i]) >= 3 {
+			result = append(result, vert)
+		}
+	}
+	return result
+}
+
+type hullFace struct {
+	verts   [3]int
+	normal  vec3.T
+	offset  float64
+	outside []int
+	removed bool
+}
+
+func (this *hullFace) distance(pt vec3.T) float64 {
+	return vec3.Dot(&this.normal, &pt) - this.offset
+}
+
+type hullBuilder struct {
+	points    []vec3.T
+	faces     []*hullFace
+	edges     map[[2]int]int // Directed edge to the face it runs counter-clockwise around
+	pending   []*hullFace    // Faces that may have points outside
+	tolerance float64
+}
+
+// start builds the largest tetrahedron it can find from the extreme points,
+// and shares the other points out among its faces.
+func (this *hullBuilder) start() error {
+	if len(this.points) < 4 {
+		return ErrFlatHull
+	}
+
+	// The farthest pair of extreme points along the axes
+	var extremes []int
+	for axis := 0; axis < 3; axis++ {
+		low, high := 0, 0
+		for i, pt := range this.points {
+			if pt[axis] < this.points[low][axis] {
+				low = i
+			}
+			if pt[axis] > this.points[high][axis] {
+				high = i
+			}
+		}
+		extremes = append(extremes, low, high)
+	}
+	var a, b int
+	var best float64
+	for _, i := range extremes {
+		for _, j := range extremes {
+			if dist := vec3.Distance(&this.points[i], &this.points[j]); dist > best {
+				a, b, best = i, j, dist
+			}
+		}
+	}
+	if best <= this.tolerance {
+		return ErrFlatHull
+	}
+
+	// The point farthest from their line
+	ab := vec3.Sub(&this.points[b], &this.points[a])
+	c, best := -1, this.tolerance
+	for i, pt := range this.points {
+		ap := vec3.Sub(&pt, &this.points[a])
+		cross := vec3.Cross(&ab, &ap)
+		if dist := cross.Length() / ab.Length(); dist > best {
+			c, best = i, dist
+		}
+	}
+	if c < 0 {
+		return ErrFlatHull
+	}
+
+	// The point farthest from their plane
+	base := this.newFace(a, b, c)
+	d, best := -1, this.tolerance
+	for i, pt := range this.points {
+		if dist := math.Abs(base.distance(pt)); dist > best {
+			d, best = i, dist
+		}
+	}
+	if d < 0 {
+		return ErrFlatHull
+	}
+	if base.distance(this.points[d]) > 0 {
+		b, c = c, b
+	}
+
+	this.addFace(a, b, c)
+	this.addFace(a, d, b)
+	this.addFace(b, d, c)
+	this.addFace(c, d, a)
+
+	all := make([]int, 0, len(this.points))
+	for i := range this.points {
+		if i != a && i != b && i != c && i != d {
+			all = append(all, i)
+		}
+	}
+	this.share(all, this.faces)
+	this.pending = append(this.pending, this.faces...)
+	return nil
+}
+
+func (this *hullBuilder) newFace(a, b, c int) *hullFace {
+	pa, pb, pc := this.points[a], this.points[b], this.points[c]
+	normal := Triangle{pa, pb, pc}.Normal()
+	return &hullFace{
+		verts:  [3]int{a, b, c},
+		normal: normal,
+		offset: vec3.Dot(&normal, &pa),
+	}
+}
+
+func (this *hullBuilder) addFace(a, b, c int) int {
+	index := len(this.faces)
+	this.faces = append(this.faces, this.newFace(a, b, c))
+	this.edges[[2]int{a, b}] = index
+	this.edges[[2]int{b, c}] = index
+	this.edges[[2]int{c, a}] = index
+	return index
+}
+
+// share gives each point to the first of the faces it lies outside of, and
+// drops those inside them all.
+func (this *hullBuilder) share(points []int, faces []*hullFace) {
+	for _, i := range points {
+		for _, face := range faces {
+			if face.distance(this.points[i]) > this.tolerance {
+				face.outside = append(face.outside, i)
+				break
+			}
+		}
+	}
+}
+
+// grow adds the farthest point outside some face to the hull, replacing the
+// faces it can see. It returns false once no points are left outside.
+func (this *hullBuilder) grow() bool {
+	var face *hullFace
+	for face == nil {
+		if len(this.pending) == 0 {
+			return false
+		}
+		last := this.pending[len(this.pending)-1]
+		this.pending = this.pending[:len(this.pending)-1]
+		if !last.removed && len(last.outside) > 0 {
+			face = last
+		}
+	}
+
+	eye, best := -1, math.Inf(-1)
+	for _, i := range face.outside {
+		if dist := face.distance(this.points[i]); dist > best {
+			eye, best = i, dist
+		}
+	}
+	eyePt := this.points[eye]
+
+	// Flood out from the face over all the faces the eye can see
+	visible := []*hullFace{face}
+	face.removed = true
+	horizon := make([][2]int, 0)
+	for next := 0; next < len(visible); next++ {
+		verts := visible[next].verts
+		for i := range verts {
+			edge := [2]int{verts[i], verts[(i+1)%3]}
+			neighbor := this.faces[this.edges[[2]int{edge[1], edge[0]}]]
+			if neighbor.removed {
+				continue
+			}
+			if neighbor.distance(eyePt) > this.tolerance {
+				neighbor.removed = true
+				visible = append(visible, neighbor)
+			} else {
+				horizon = append(horizon, edge)
+			}
+		}
+	}
+
+	// Faces found later can still border ones found earlier, so keep only
+	// edges that ended up between a visible and a hidden face
+	orphans := make([]int, 0)
+	for _, visibleFace := range visible {
+		verts := visibleFace.verts
+		for i := range verts {
+			delete(this.edges, [2]int{verts[i], verts[(i+1)%3]})
+		}
+		for _, i := range visibleFace.outside {
+			if i != eye {
+				orphans = append(orphans, i)
+			}
+		}
+		visibleFace.outside = nil
+	}
+
+	added := make([]*hullFace, 0, len(horizon))
+	for _, edge := range horizon {
+		if neighbor, exists := this.edges[[2]int{edge[1], edge[0]}]; !exists || this.faces[neighbor].removed {
+			continue
+		}
+		added = append(added, this.faces[this.addFace(edge[0], edge[1], eye)])
+	}
+	this.share(orphans, added)
+	this.pending = append(this.pending, added...)
+	return true
+}
+
+// result gathers the faces left, numbering only the points they use.
+func (this *hullBuilder) result() *IndexBuffer {
+	result := &IndexBuffer{Vertices: make([]vec3.T, 0), Faces: make([]Face, 0)}
+	indices := make(map[int]uint32)
+	for _, face := range this.faces {
+		if face.removed {
+			continue
+		}
+		var out Face
+		for i, vert := range face.verts {
+			index, exists := indices[vert]
+			if !exists {
+				index = uint32(len(result.Vertices))
+				indices[vert] = index
+				result.Vertices = append(result.Vertices, this.points[vert])
+			}
+			out[i] = index
+		}
+		result.Faces = append(result.Faces, out)
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package mesh
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// checkHull fails unless the hull is closed, convex and holds all the points.
+func checkHull(t *testing.T, hull *IndexBuffer, points []vec3.T) {
+	edges := make(map[[2]uint32]bool)
+	for _, face := range hull.Faces {
+		for i := range face {
+			edges[[2]uint32{face[i], face[(i+1)%3]}] = true
+		}
+	}
+	for edge := range edges {
+		if !edges[[2]uint32{edge[1], edge[0]}] {
+			t.Fatalf("Hull is open along %v", edge)
+		}
+	}
+	if euler := len(hull.Vertices) - len(edges)/2 + len(hull.Faces); euler != 2 {
+		t.Fatalf("Expected Euler characteristic 2, got %d", euler)
+	}
+
+	for _, face := range hull.Faces {
+		tri := Triangle{hull.Vertices[face[0]], hull.Vertices[face[1]], hull.Vertices[face[2]]}
+		normal := tri.Normal()
+		for _, pt := range points {
+			offset := vec3.Sub(&pt, &tri[0])
+			if dist := vec3.Dot(&normal, &offset); dist > 1e-9 {
+				t.Fatalf("Point %v is %v outside the hull", pt, dist)
+			}
+		}
+	}
+}
+
+func TestConvexHull(t *testing.T) {
+	// Corners, plus duplicates, points on the faces and edges, and inside
+	points := make([]vec3.T, 0)
+	for i := 0; i < 8; i++ {
+		corner := vec3.T{float64(i & 1), float64(i >> 1 & 1), float64(i >> 2 & 1)}
+		points = append(points, corner, corner)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		pt := vec3.T{rng.Float64(), rng.Float64(), rng.Float64()}
+		switch i % 4 {
+		case 1:
+			pt[i%3] = float64(i / 4 % 2)
+		case 2:
+			pt[i%3] = 0
+			pt[(i+1)%3] = 1
+		case 3:
+			pt = vec3.T{0.5, 0.5, 0.5}
+		}
+		points = append(points, pt)
+	}
+	rng.Shuffle(len(points), func(i, j int) { points[i], points[j] = points[j], points[i] })
+
+	hull, err := ConvexHullPoints(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHull(t, hull, points)
+	if len(hull.Vertices) != 8 {
+		t.Fatalf("Expected the 8 corners, got %d vertices", len(hull.Vertices))
+	}
+	if volume := Volume(hull); math.Abs(volume-1) > 1e-9 {
+		t.Fatalf("Expected volume 1, got %v", volume)
+	}
+	if area := Area(hull); math.Abs(area-6) > 1e-9 {
+		t.Fatalf("Expected area 6, got %v", area)
+	}
+
+	// Points on a sphere are all on the hull
+	points = sphereDirections(500)
+	if hull, err = ConvexHullPoints(points); err != nil {
+		t.Fatal(err)
+	}
+	checkHull(t, hull, points)
+	if len(hull.Vertices) != 500 {
+		t.Fatalf("Expected all 500 points on the hull, got %d", len(hull.Vertices))
+	}
+
+	table := newTableMesh()
+	if hull, err = ConvexHull(&table); err != nil {
+		t.Fatal(err)
+	}
+	points = points[:0]
+	for _, tri := range table {
+		points = append(points, tri[:]...)
+	}
+	checkHull(t, hull, points)
+
+	// The slab over a frustum from the foot of the leg to the slab
+	expected := 10*10*2 + 5.0/3*(2*2+10*10+2*10)
+	if volume := Volume(hull); math.Abs(volume-expected) > 1e-9 {
+		t.Fatalf("Expected volume %v, got %v", expected, volume)
+	}
+}
+
+func TestConvexHullRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for round := 0; round < 20; round++ {
+		points := make([]vec3.T, 300)
+		for i := range points {
+			if round%2 == 0 {
+				points[i] = vec3.T{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}
+			} else {
+				// Integer points, with many on the same planes
+				points[i] = vec3.T{float64(rng.Intn(5)), float64(rng.Intn(5)), float64(rng.Intn(5))}
+			}
+		}
+
+		hull, err := ConvexHullPoints(points)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkHull(t, hull, points)
+	}
+}
+
+func TestConvexHullFlat(t *testing.T) {
+	for _, points := range [][]vec3.T{
+		{},
+		{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {3, 0, 0}, {1, 0, 0}},
+		{{0, 0, 1}, {1, 0, 1}, {0, 1, 1}, {1, 1, 1}, {0.5, 0.5, 1}},
+	} {
+		if _, err := ConvexHullPoints(points); err != ErrFlatHull {
+			t.Fatalf("Expected ErrFlatHull for %v, got %v", points, err)
+		}
+	}
+}
@@ -2,7 +2,8 @@ package mesh
 
 import "github.com/ungerik/go3d/float64/vec3"
 
-type Face [3]uint16
+// Face holds three indices into Vertices.
+type Face [3]uint32
 
 type IndexBuffer struct {
 	Vertices []vec3.T
@@ -34,8 +35,8 @@ func (this *IndexBuffer) ConvertFrom(mesh Mesh) {
 	this.Vertices = make([]vec3.T, 0)
 	this.Faces = make([]Face, 0, mesh.NumTriangles())
 
-	uniqueVertices := make(map[vec3.T]uint16)
-	var currIndex uint16
+	uniqueVertices := make(map[vec3.T]uint32)
+	var currIndex uint32
 
 	var face Face
 	for tri := range mesh.read() {
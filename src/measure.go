@@ -0,0 +1,24 @@
+package mesh
+
+import "github.com/ungerik/go3d/float64/vec3"
+
+// Area returns the total surface area of the mesh.
+func Area(mesh Mesh) float64 {
+	var area float64
+	for tri := range mesh.read() {
+		area += tri.Area()
+	}
+	return area
+}
+
+// Volume returns the volume enclosed by a closed mesh, as the sum of the
+// signed volumes of the tetrahedra joining each triangle to the origin. It is
+// negative if the triangles face inwards.
+func Volume(mesh Mesh) float64 {
+	var volume float64
+	for tri := range mesh.read() {
+		cross := vec3.Cross(&tri[1], &tri[2])
+		volume += vec3.Dot(&tri[0], &cross) / 6
+	}
+	return volume
+}
@@ -1,10 +1,16 @@
 package mesh
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
 )
 
 const cubePath = "resources/cube.stl"
@@ -39,6 +45,49 @@ func TestStl(t *testing.T) {
 	}
 }
 
+// TestStlRecord round-trips a standard binary STL record: 12 little endian
+// float32s for the normal and vertices, then a 2 byte attribute.
+func TestStlRecord(t *testing.T) {
+	tri := Triangle{{0, 0, 0.5}, {1.25, 0, 0.5}, {0, -2, 0.5}}
+	values := []float32{0, 0, -1, 0, 0, 0.5, 1.25, 0, 0.5, 0, -2, 0.5}
+
+	record := make([]byte, headerLen, headerLen+uint32Size+50)
+	record = binary.LittleEndian.AppendUint32(record, 1)
+	for _, value := range values {
+		record = binary.LittleEndian.AppendUint32(record, math.Float32bits(value))
+	}
+	record = append(record, 0, 0)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "record.stl")
+	if err := os.WriteFile(path, record, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stl, err := NewStlFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(stl)
+	if len(abuf) != 1 || abuf[0] != tri {
+		t.Fatalf("Read %v, expected %v", abuf, tri)
+	}
+
+	copyPath := filepath.Join(dir, "copy.stl")
+	copied, err := NewStlFile(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied.ConvertFrom(&abuf)
+	written, err := os.ReadFile(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written[headerLen:], record[headerLen:]) {
+		t.Fatalf("Wrote record % x, expected % x", written[headerLen:], record[headerLen:])
+	}
+}
+
 func TestArrays(t *testing.T) {
 	stl, err := NewStlFile(cubePath)
 	if err != nil {
@@ -75,3 +124,32 @@ func (this *ArrayBuffer) Equals(other *ArrayBuffer) bool {
 
 	return true
 }
+
+// newBoxMesh returns the outward-facing triangles of an axis-aligned box.
+func newBoxMesh(lower, upper vec3.T) ArrayBuffer {
+	var corners [8]vec3.T
+	for i := range corners {
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<uint(axis)) == 0 {
+				corners[i][axis] = lower[axis]
+			} else {
+				corners[i][axis] = upper[axis]
+			}
+		}
+	}
+
+	faces := [12][3]int{
+		{0, 2, 3}, {0, 3, 1}, // -z
+		{4, 5, 7}, {4, 7, 6}, // +z
+		{0, 1, 5}, {0, 5, 4}, // -y
+		{2, 6, 7}, {2, 7, 3}, // +y
+		{0, 4, 6}, {0, 6, 2}, // -x
+		{1, 3, 7}, {1, 7, 5}, // +x
+	}
+
+	abuf := make(ArrayBuffer, len(faces))
+	for i, face := range faces {
+		abuf[i] = Triangle{corners[face[0]], corners[face[1]], corners[face[2]]}
+	}
+	return abuf
+}
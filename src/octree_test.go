@@ -1,21 +1,36 @@
 package mesh
 
-/*func TestOctree(t *testing.T) {
-	stl, err := NewStlFile("resources/cube.stl")
-	if err != nil {
-		t.Fatal(err)
-	}
+import (
+	"math"
+	"testing"
 
-	abuf := ArrayBuffer{}
-	abuf.ConvertFrom(stl)
+	"github.com/ungerik/go3d/float64/vec3"
+)
 
-	bbox := BoxTriangles(abuf...).ExpandToCube()
+func TestOctreeNearest(t *testing.T) {
+	abuf := newBoxMesh(vec3.T{0, 0, 0}, vec3.T{10, 10, 10})
+	abuf = append(abuf, newBoxMesh(vec3.T{20, 3, 3}, vec3.T{24, 7, 7})...)
 
+	bbox := BoxTriangles(abuf...).ExpandToCube()
 	tree := NewOctree(8, bbox)
-
 	for _, tri := range abuf {
 		tree.Insert(NewBoxedTriangle(tri))
 	}
 
-	fmt.Println(tree)
-}*/
+	for _, pt := range []vec3.T{{5, 5, 5}, {15, 5, 5}, {-3, -4, 12}, {22, 5, 5}, {30, 0, 0}} {
+		closest, ok := tree.Nearest(pt)
+		if !ok {
+			t.Fatal("Nearest found nothing")
+		}
+
+		bestDist := math.Inf(1)
+		for _, tri := range abuf {
+			candidate := tri.ClosestPoint(pt)
+			bestDist = math.Min(bestDist, vec3.Distance(&pt, &candidate))
+		}
+
+		if dist := vec3.Distance(&pt, &closest); math.Abs(dist-bestDist) > 1e-9 {
+			t.Fatalf("Nearest to %v is %v away, brute force found %v", pt, dist, bestDist)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// OrientationObjective weighs the costs of printing a part in some
+// orientation. Each cost is made scale free, so that the weights compare.
+type OrientationObjective struct {
+	// Area of the overhangs, over the surface area of the part
+	Overhang float64
+	// Volume between the overhangs and the build plate, over the volume of
+	// the part
+	Support float64
+	// Height of the part, over the diagonal of its bounding box
+	Height float64
+	// Area lying flat on the build plate, over the surface area of the part.
+	// It lowers the cost, since a wide base holds the part down.
+	Contact float64
+
+	// Surfaces leaning further than this from vertical, in degrees, need
+	// support. Defaults to 45.
+	OverhangAngle float64
+	// Number of directions tried besides those of the larger sides of the
+	// convex hull. Defaults to 256.
+	Samples int
+}
+
+func DefaultOrientationObjective() *OrientationObjective {
+	return &OrientationObjective{
+		Overhang: 1,
+		Support:  1,
+		Height:   0.25,
+		Contact:  0.5,
+	}
+}
+
+func (this *OrientationObjective) withDefaults() *OrientationObjective {
+	objective := *this
+	if objective.OverhangAngle == 0 {
+		objective.OverhangAngle = 45
+	}
+	if objective.Samples <= 0 {
+		objective.Samples = 256
+	}
+	return &objective
+}
+
+// Number of the largest sides of the hull tried as the base
+const orientationFaces = 32
+
+// OptimizeOrientation searches for the rotation that is cheapest to print the
+// mesh in, resting on the build plate at z = 0. Candidates put each of the
+// larger sides of its convex hull or one of a spread of directions on the
+// sphere down. A nil objective uses DefaultOrientationObjective. Ties keep the
+// mesh as it is.
+func OptimizeOrientation(mesh Mesh, objective *OrientationObjective) Transform {
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	if len(abuf) == 0 {
+		return IdentityTransform()
+	}
+	if objective == nil {
+		objective = DefaultOrientationObjective()
+	}
+	search := newOrientationSearch(abuf, objective.withDefaults())
+
+	best := vec3.T{0, 0, -1}
+	bestCost := search.cost(best)
+	for _, down := range search.candidates() {
+		if cost := search.cost(down); cost < bestCost-epsilon*epsilon {
+			best, bestCost = down, cost
+		}
+	}
+
+	rotation := RotationBetween(best, vec3.T{0, 0, -1})
+	up := best.Inverted()
+	lift := Translation(vec3.T{0, 0, -search.lowest(up)})
+	return rotation.Then(&lift)
+}
+
+type orientationSearch struct {
+	objective *OrientationObjective
+	tris      ArrayBuffer
+	normals   []vec3.T
+	areas     []float64
+	area      float64
+	volume    float64
+	diagonal  float64
+}
+
+func newOrientationSearch(abuf ArrayBuffer, objective *OrientationObjective) *orientationSearch {
+	search := &orientationSearch{
+		objective: objective,
+		tris:      abuf,
+		normals:   make([]vec3.T, len(abuf)),
+		areas:     make([]float64, len(abuf)),
+	}
+	for i, tri := range abuf {
+		search.normals[i] = tri.Normal()
+		search.areas[i] = tri.Area()
+		search.area += search.areas[i]
+	}
+
+	box := BoxTriangles(abuf...)
+	search.diagonal = vec3.Distance(&box.LowerBound, &box.UpperBound)
+
+	// Open meshes have no volume to speak of, so compare support against
+	// the part's skin instead
+	search.volume = math.Abs(Volume(&abuf))
+	if search.volume < epsilon {
+		search.volume = search.area * search.diagonal
+	}
+	return search
+}
+
+// candidates returns the directions to try as down. Sides of the hull bridge
+// gaps between parts of the mesh, so a part can rest on a side no triangle of
+// the mesh lies in.
+func (this *orientationSearch) candidates() []vec3.T {
+	result := []vec3.T{
+		{1, 0, 0}, {-1, 0, 0},
+		{0, 1, 0}, {0, -1, 0},
+		{0, 0, 1},
+	}
+
+	// The part can rest on any side of its hull. Flat meshes have none, so
+	// fall back to their own triangles.
+	sides := this.tris
+	if hull, err := ConvexHull(&this.tris); err == nil {
+		sides = ArrayBuffer{}
+		sides.ConvertFrom(hull)
+	}
+
+	// Triangles of the same flat side share a normal, up to rounding
+	faces := make(map[[3]int64]float64)
+	normals := make(map[[3]int64]vec3.T)
+	for _, tri := range sides {
+		area := tri.Area()
+		if area == 0 {
+			continue
+		}
+		normal := tri.Normal()
+		key := [3]int64{}
+		for j := range key {
+			key[j] = int64(math.Floor(normal[j]*1e4 + 0.5))
+		}
+		faces[key] += area
+		if _, exists := normals[key]; !exists {
+			normals[key] = normal
+		}
+	}
+	keys := make([][3]int64, 0, len(faces))
+	for key := range faces {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if faces[keys[i]] != faces[keys[j]] {
+			return faces[keys[i]] > faces[keys[j]]
+		}
+		for k := range keys[i] {
+			if keys[i][k] != keys[j][k] {
+				return keys[i][k] < keys[j][k]
+			}
+		}
+		return false
+	})
+	if len(keys) > orientationFaces {
+		keys = keys[:orientationFaces]
+	}
+	for _, key := range keys {
+		result = append(result, normals[key])
+	}
+
+	return append(result, sphereDirections(this.objective.Samples)...)
+}
+
+// sphereDirections spreads count directions evenly over the sphere, along a
+// golden spiral.
+func sphereDirections(count int) []vec3.T {
+	result := make([]vec3.T, count)
+	golden := math.Pi * (3 - math.Sqrt(5))
+	for i := range result {
+		z := 1 - (2*float64(i)+1)/float64(count)
+		radius := math.Sqrt(1 - z*z)
+		angle := golden * float64(i)
+		result[i] = vec3.T{radius * math.Cos(angle), radius * math.Sin(angle), z}
+	}
+	return result
+}
+
+func (this *orientationSearch) lowest(up vec3.T) float64 {
+	result := math.Inf(1)
+	for _, tri := range this.tris {
+		for _, vert := range tri {
+			result = math.Min(result, vec3.Dot(&vert, &up))
+		}
+	}
+	return result
+}
+
+// cost scores the part resting on its side facing down.
+func (this *orientationSearch) cost(down vec3.T) float64 {
+	up := down.Inverted()
+	bottom := this.lowest(up)
+	threshold := math.Sin(this.objective.OverhangAngle * math.Pi / 180)
+
+	var overhang, support, contact, top float64
+	for i, tri := range this.tris {
+		lower, upper := math.Inf(1), math.Inf(-1)
+		for _, vert := range tri {
+			height := vec3.Dot(&vert, &up) - bottom
+			lower, upper = math.Min(lower, height), math.Max(upper, height)
+		}
+		top = math.Max(top, upper)
+
+		facing := -vec3.Dot(&this.normals[i], &up)
+		if upper < epsilon {
+			if facing > 1-epsilon {
+				contact += this.areas[i]
+			}
+			continue
+		}
+		if facing > threshold {
+			// Support runs from the middle of the overhang to the plate
+			overhang += this.areas[i]
+			support += this.areas[i] * facing * (lower + upper) / 2
+		}
+	}
+
+	return this.objective.Overhang*overhang/this.area +
+		this.objective.Support*support/this.volume +
+		this.objective.Height*top/this.diagonal -
+		this.objective.Contact*contact/this.area
+}
@@ -0,0 +1,119 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func closeVec(a, b vec3.T) bool {
+	return vec3.Distance(&a, &b) < 1e-9
+}
+
+func TestTransform(t *testing.T) {
+	quarter := Rotation(vec3.UnitZ, math.Pi/2)
+	if pt := quarter.Apply(vec3.UnitX); !closeVec(pt, vec3.UnitY) {
+		t.Fatalf("Expected a quarter turn to take x to y, got %v", pt)
+	}
+
+	shift := Translation(vec3.T{1, 2, 3})
+	combined := quarter.Then(&shift)
+	if pt := combined.Apply(vec3.T{1, 0, 0}); !closeVec(pt, vec3.T{1, 3, 3}) {
+		t.Fatalf("Expected rotation and then translation, got %v", pt)
+	}
+
+	inverse := combined.Inverse()
+	for _, pt := range []vec3.T{{0, 0, 0}, {1, -2, 5}, {-3, 4, 0.5}} {
+		if back := inverse.Apply(combined.Apply(pt)); !closeVec(back, pt) {
+			t.Fatalf("Expected %v back, got %v", pt, back)
+		}
+	}
+
+	for _, to := range []vec3.T{{0, 0, 1}, {0, 0, -1}, {1, 1, 0}, {-1, 0, 0}} {
+		rotation := RotationBetween(vec3.UnitZ, to)
+		if dir := rotation.ApplyVector(vec3.UnitZ); !closeVec(dir, to.Normalized()) {
+			t.Fatalf("Expected z turned to %v, got %v", to, dir)
+		}
+		if det := rotation.determinant(); math.Abs(det-1) > 1e-9 {
+			t.Fatalf("Rotation has determinant %v", det)
+		}
+	}
+
+	mirror := IdentityTransform()
+	mirror.Linear[0][0] = -1
+	box := newBoxMesh(vec3.T{0, 0, 0}, vec3.T{1, 2, 3})
+	mirrored := mirror.ApplyMesh(&box)
+	if volume := Volume(&mirrored); math.Abs(volume-6) > 1e-9 {
+		t.Fatalf("Expected mirrored volume 6, got %v", volume)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	box := newBoxMesh(vec3.T{1, 1, 1}, vec3.T{3, 4, 5})
+	if area := Area(&box); math.Abs(area-2*(6+8+12)) > 1e-9 {
+		t.Fatalf("Expected area 52, got %v", area)
+	}
+	if volume := Volume(&box); math.Abs(volume-24) > 1e-9 {
+		t.Fatalf("Expected volume 24, got %v", volume)
+	}
+}
+
+func TestOptimizeOrientation(t *testing.T) {
+	// A plate standing on its edge is best laid flat
+	plate := newBoxMesh(vec3.T{0, 0, 0}, vec3.T{2, 10, 10})
+	transform := OptimizeOrientation(&plate, nil)
+	box := BoxTriangles(transform.ApplyMesh(&plate)...)
+	if math.Abs(box.LowerBound[2]) > 1e-9 || math.Abs(box.UpperBound[2]-2) > 1e-9 {
+		t.Fatalf("Expected the plate flat on the build plate, got %v to %v", box.LowerBound[2], box.UpperBound[2])
+	}
+
+	// Tilted any which way, it still lands on one of its sides
+	tilt := Rotation(vec3.T{1, 2, 3}, 0.7)
+	tilted := tilt.ApplyMesh(&plate)
+	transform = OptimizeOrientation(&tilted, nil)
+	box = BoxTriangles(transform.ApplyMesh(&tilted)...)
+	if math.Abs(box.LowerBound[2]) > 1e-9 || math.Abs(box.UpperBound[2]-2) > 1e-9 {
+		t.Fatalf("Expected the tilted plate laid flat, got %v to %v", box.LowerBound[2], box.UpperBound[2])
+	}
+
+	// A table is best printed upside down
+	table := newTableMesh()
+	transform = OptimizeOrientation(&table, nil)
+	turned := transform.ApplyMesh(&table)
+	// Only the hidden top of the leg, where it meets the slab, faces down
+	for _, i := range Overhangs(&turned, &SupportOptions{}) {
+		if area := turned[i].Area(); math.Abs(turned[i][0][2]-2) > 1e-9 || math.Abs(area-2) > 1e-9 {
+			t.Fatalf("Triangle %v is an overhang", turned[i])
+		}
+	}
+	box = BoxTriangles(turned...)
+	if math.Abs(box.LowerBound[2]) > 1e-9 || math.Abs(box.UpperBound[2]-7) > 1e-9 {
+		t.Fatalf("Expected the table upside down, got %v to %v", box.LowerBound[2], box.UpperBound[2])
+	}
+	if up := transform.ApplyVector(vec3.UnitZ); !closeVec(up, vec3.T{0, 0, -1}) {
+		t.Fatalf("Expected the table upside down, got up %v", up)
+	}
+
+	// Nothing beats a cube as it is
+	cube := newBoxMesh(vec3.T{0, 0, 0}, vec3.T{1, 1, 1})
+	if transform := OptimizeOrientation(&cube, nil); transform != IdentityTransform() {
+		t.Fatalf("Expected the cube left alone, got %v", transform)
+	}
+}
+
+func TestOrientationCandidates(t *testing.T) {
+	// Two cubes apart on a diagonal rest on a slanted side of their hull,
+	// which no triangle of the mesh lies in
+	abuf := append(newBoxMesh(vec3.T{0, 0, 0}, vec3.T{1, 1, 1}), newBoxMesh(vec3.T{2, 0, 2}, vec3.T{3, 1, 3})...)
+	search := newOrientationSearch(abuf, DefaultOrientationObjective().withDefaults())
+
+	slanted := vec3.T{1, 0, -1}
+	slanted.Normalize()
+	for _, down := range search.candidates() {
+		if closeVec(down, slanted) {
+			return
+		}
+	}
+	t.Fatalf("The slanted side of the hull %v is not a candidate", slanted)
+}
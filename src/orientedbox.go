@@ -0,0 +1,357 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// OrientedBox is a box along any three square axes. Axes are unit length
+// and right handed.
+type OrientedBox struct {
+	Center      vec3.T
+	Axes        [3]vec3.T
+	HalfExtents vec3.T
+}
+
+// OrientedBoxPCA fits a box along the principal axes of the surface of the
+// mesh. It is quick, but can be well off the smallest box. It returns nil for
+// an empty mesh.
+func OrientedBoxPCA(mesh Mesh) *OrientedBox {
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	if len(abuf) == 0 {
+		return nil
+	}
+	return fitOrientedBox(meshPoints(abuf), principalAxes(abuf))
+}
+
+// MinimalOrientedBox searches for the box of least volume holding the mesh.
+// Each side of the convex hull is tried as a side of the box, turned in its
+// plane to lie along each edge of the hull's outline seen from that side.
+// This finds the smallest box for most parts, and is never worse than the
+// principal axes or the axis aligned box. It returns nil for an empty mesh.
+func MinimalOrientedBox(mesh Mesh) *OrientedBox {
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	if len(abuf) == 0 {
+		return nil
+	}
+	points := meshPoints(abuf)
+
+	best := fitOrientedBox(points, principalAxes(abuf))
+	if aligned := fitOrientedBox(points, [3]vec3.T{vec3.UnitX, vec3.UnitY, vec3.UnitZ}); aligned.Volume() < best.Volume() {
+		best = aligned
+	}
+
+	hull, err := ConvexHullPoints(points)
+	if err != nil {
+		// Flat parts have their box in their own plane, found as above
+		return best
+	}
+
+	tried := make(map[[3]int64]bool)
+	for _, face := range hull.Faces {
+		normal := Triangle{hull.Vertices[face[0]], hull.Vertices[face[1]], hull.Vertices[face[2]]}.Normal()
+		key := [3]int64{}
+		for i := range key {
+			key[i] = int64(math.Floor(normal[i]*1e6 + 0.5))
+		}
+		if tried[key] {
+			continue
+		}
+		tried[key] = true
+
+		if box := boxOnSide(hull.Vertices, normal); box.Volume() < best.Volume() {
+			best = box
+		}
+	}
+	return best
+}
+
+// boxOnSide returns the smallest box holding the points with a side square
+// to normal, using rotating calipers on their outline in its plane.
+func boxOnSide(points []vec3.T, normal vec3.T) *OrientedBox {
+	frame := newBuildFrame(normal)
+	flat := make([][2]float64, len(points))
+	for i, pt := range points {
+		local := frame.toFrame(pt)
+		flat[i] = [2]float64{local[0], local[1]}
+	}
+	outline := convexHull2D(flat)
+
+	bestArea := math.Inf(1)
+	var bestDir [2]float64
+	for i := range outline {
+		next := outline[(i+1)%len(outline)]
+		dir := [2]float64{next[0] - outline[i][0], next[1] - outline[i][1]}
+		length := math.Hypot(dir[0], dir[1])
+		if length == 0 {
+			continue
+		}
+		dir = [2]float64{dir[0] / length, dir[1] / length}
+
+		lowA, highA, lowB, highB := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+		for _, pt := range outline {
+			a := pt[0]*dir[0] + pt[1]*dir[1]
+			b := pt[1]*dir[0] - pt[0]*dir[1]
+			lowA, highA = math.Min(lowA, a), math.Max(highA, a)
+			lowB, highB = math.Min(lowB, b), math.Max(highB, b)
+		}
+		if area := (highA - lowA) * (highB - lowB); area < bestArea {
+			bestArea, bestDir = area, dir
+		}
+	}
+
+	along := frame.fromFrame(vec3.T{bestDir[0], bestDir[1], 0})
+	across := vec3.Cross(&frame.axes[2], &along)
+	return fitOrientedBox(points, [3]vec3.T{along, across, frame.axes[2]})
+}
+
+// convexHull2D returns the corners of the convex hull of the points in
+// counter-clockwise order, by Andrew's monotone chain.
+func convexHull2D(points [][2]float64) [][2]float64 {
+	sorted := append([][2]float64{}, points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+	if len(sorted) < 3 {
+		return sorted
+	}
+
+	cross := func(o, a, b [2]float64) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+	result := make([][2]float64, 0, 2*len(sorted))
+	for pass := 0; pass < 2; pass++ {
+		start := len(result)
+		for _, pt := range sorted {
+			for len(result) >= start+2 && cross(result[len(result)-2], result[len(result)-1], pt) <= 0 {
+				result = result[:len(result)-1]
+			}
+			result = append(result, pt)
+		}
+		// The last point of each chain starts the other
+		result = result[:len(result)-1]
+
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	}
+	return result
+}
+
+func meshPoints(abuf ArrayBuffer) []vec3.T {
+	result := make([]vec3.T, 0, len(abuf)*3)
+	for _, tri := range abuf {
+		result = append(result, tri[:]...)
+	}
+	return result
+}
+
+// principalAxes returns the eigenvectors of the covariance of the surface,
+// treating it as a shell of even thickness, largest spread first.
+func principalAxes(abuf ArrayBuffer) [3]vec3.T {
+	var total float64
+	var mean vec3.T
+	var moments [3][3]float64
+	for _, tri := range abuf {
+		area := tri.Area()
+		centroid := tri.Centroid()
+		total += area
+		for i := 0; i < 3; i++ {
+			mean[i] += area * centroid[i]
+			for j := 0; j < 3; j++ {
+				sum := 9 * centroid[i] * centroid[j]
+				for _, vert := range tri {
+					sum += vert[i] * vert[j]
+				}
+				moments[i][j] += area / 12 * sum
+			}
+		}
+	}
+	if total == 0 {
+		return [3]vec3.T{vec3.UnitX, vec3.UnitY, vec3.UnitZ}
+	}
+
+	mean.Scale(1 / total)
+	var covariance [3][3]float64
+	for i := range covariance {
+		for j := range covariance[i] {
+			covariance[i][j] = moments[i][j]/total - mean[i]*mean[j]
+		}
+	}
+	return symmetricEigenvectors(covariance)
+}
+
+// symmetricEigenvectors diagonalizes a symmetric matrix by Jacobi rotations,
+// and returns its eigenvectors by falling eigenvalue as a right handed basis.
+func symmetricEigenvectors(m [3][3]float64) [3]vec3.T {
+	vectors := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := m[0][1]*m[0][1] + m[0][2]*m[0][2] + m[1][2]*m[1][2]
+		if off < 1e-30 {
+			break
+		}
+
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if m[p][q] == 0 {
+					continue
+				}
+
+				// Rotate in the pq plane to zero m[p][q]
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < 3; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p], m[k][q] = c*mkp-s*mkq, s*mkp+c*mkq
+				}
+				for k := 0; k < 3; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k], m[q][k] = c*mpk-s*mqk, s*mpk+c*mqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := vectors[k][p], vectors[k][q]
+					vectors[k][p], vectors[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+
+	order := []int{0, 1, 2}
+	sort.Slice(order, func(i, j int) bool {
+		return m[order[i]][order[i]] > m[order[j]][order[j]]
+	})
+	var result [3]vec3.T
+	for i := 0; i < 2; i++ {
+		result[i] = vec3.T{vectors[0][order[i]], vectors[1][order[i]], vectors[2][order[i]]}
+		result[i].Normalize()
+	}
+	result[2] = vec3.Cross(&result[0], &result[1])
+	result[2].Normalize()
+	return result
+}
+
+// fitOrientedBox returns the smallest box along the axes holding the points.
+// The third axis is remade from the first two, so that the axes are right
+// handed.
+func fitOrientedBox(points []vec3.T, axes [3]vec3.T) *OrientedBox {
+	axes[0].Normalize()
+	axes[2] = vec3.Cross(&axes[0], &axes[1])
+	axes[2].Normalize()
+	axes[1] = vec3.Cross(&axes[2], &axes[0])
+
+	var lower, upper vec3.T
+	for i := range axes {
+		lower[i], upper[i] = math.Inf(1), math.Inf(-1)
+		for _, pt := range points {
+			dot := vec3.Dot(&pt, &axes[i])
+			lower[i], upper[i] = math.Min(lower[i], dot), math.Max(upper[i], dot)
+		}
+	}
+
+	result := &OrientedBox{Axes: axes}
+	for i, axis := range axes {
+		result.HalfExtents[i] = (upper[i] - lower[i]) / 2
+		offset := axis.Scaled((upper[i] + lower[i]) / 2)
+		result.Center.Add(&offset)
+	}
+	return result
+}
+
+func (this *OrientedBox) Volume() float64 {
+	return 8 * this.HalfExtents[0] * this.HalfExtents[1] * this.HalfExtents[2]
+}
+
+func (this *OrientedBox) Corners() [8]vec3.T {
+	var result [8]vec3.T
+	for i := range result {
+		result[i] = this.Center
+		for axis := 0; axis < 3; axis++ {
+			offset := this.Axes[axis].Scaled(this.HalfExtents[axis])
+			if i&(1<<uint(axis)) == 0 {
+				offset.Invert()
+			}
+			result[i].Add(&offset)
+		}
+	}
+	return result
+}
+
+func (this *OrientedBox) ContainsPoint(pt vec3.T) bool {
+	offset := vec3.Sub(&pt, &this.Center)
+	for i, axis := range this.Axes {
+		if math.Abs(vec3.Dot(&offset, &axis)) > this.HalfExtents[i]+epsilon {
+			return false
+		}
+	}
+	return true
+}
+
+// Transform returns the transform from the frame of the box, where it is
+// centered on the origin along the axes, to where it is. Its inverse lines a
+// mesh up with its box.
+func (this *OrientedBox) Transform() Transform {
+	result := Translation(this.Center)
+	for i, axis := range this.Axes {
+		for j := range axis {
+			result.Linear[j][i] = axis[j]
+		}
+	}
+	return result
+}
+
+// Intersects tests the boxes for overlap on the separating axes: the axes of
+// both boxes and the cross products of each pair, from Real-Time Collision
+// Detection by Christer Ericson, section 4.4.1.
+func (this *OrientedBox) Intersects(other *OrientedBox) bool {
+	var rotation, absRotation [3][3]float64
+	for i := range this.Axes {
+		for j := range other.Axes {
+			rotation[i][j] = vec3.Dot(&this.Axes[i], &other.Axes[j])
+			// Pairs of nearly parallel axes have a cross product too short
+			// to trust, so pad them
+			absRotation[i][j] = math.Abs(rotation[i][j]) + epsilon
+		}
+	}
+
+	offset := vec3.Sub(&other.Center, &this.Center)
+	t := vec3.T{vec3.Dot(&offset, &this.Axes[0]), vec3.Dot(&offset, &this.Axes[1]), vec3.Dot(&offset, &this.Axes[2])}
+	a, b := this.HalfExtents, other.HalfExtents
+
+	for i := 0; i < 3; i++ {
+		rb := b[0]*absRotation[i][0] + b[1]*absRotation[i][1] + b[2]*absRotation[i][2]
+		if math.Abs(t[i]) > a[i]+rb {
+			return false
+		}
+	}
+	for j := 0; j < 3; j++ {
+		ra := a[0]*absRotation[0][j] + a[1]*absRotation[1][j] + a[2]*absRotation[2][j]
+		if math.Abs(t[0]*rotation[0][j]+t[1]*rotation[1][j]+t[2]*rotation[2][j]) > ra+b[j] {
+			return false
+		}
+	}
+	for i := 0; i < 3; i++ {
+		i1, i2 := (i+1)%3, (i+2)%3
+		for j := 0; j < 3; j++ {
+			j1, j2 := (j+1)%3, (j+2)%3
+			ra := a[i1]*absRotation[i2][j] + a[i2]*absRotation[i1][j]
+			rb := b[j1]*absRotation[i][j2] + b[j2]*absRotation[i][j1]
+			if math.Abs(t[i2]*rotation[i1][j]-t[i1]*rotation[i2][j]) > ra+rb {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func checkOrientedBox(t *testing.T, box *OrientedBox, abuf ArrayBuffer) {
+	for i := range box.Axes {
+		if length := box.Axes[i].Length(); math.Abs(length-1) > 1e-9 {
+			t.Fatalf("Axis %d has length %v", i, length)
+		}
+		next := box.Axes[(i+1)%3]
+		if dot := vec3.Dot(&box.Axes[i], &next); math.Abs(dot) > 1e-9 {
+			t.Fatalf("Axes %d and %d aren't square", i, (i+1)%3)
+		}
+	}
+	cross := vec3.Cross(&box.Axes[0], &box.Axes[1])
+	if !closeVec(cross, box.Axes[2]) {
+		t.Fatal("Axes aren't right handed")
+	}
+
+	for _, tri := range abuf {
+		for _, vert := range tri {
+			if !box.ContainsPoint(vert) {
+				t.Fatalf("Box doesn't hold %v", vert)
+			}
+		}
+	}
+}
+
+func TestOrientedBox(t *testing.T) {
+	place := Rotation(vec3.T{1, -2, 0.5}, 1.1)
+	shift := Translation(vec3.T{5, -3, 8})
+	place = place.Then(&shift)
+	abuf := newBoxMesh(vec3.T{-1, -2, -4}, vec3.T{1, 2, 4})
+	turned := place.ApplyMesh(&abuf)
+
+	for name, fit := range map[string]func(Mesh) *OrientedBox{
+		"PCA":     OrientedBoxPCA,
+		"minimal": MinimalOrientedBox,
+	} {
+		box := fit(&turned)
+		checkOrientedBox(t, box, turned)
+		if volume := box.Volume(); math.Abs(volume-64) > 1e-6 {
+			t.Fatalf("Expected %s volume 64, got %v", name, volume)
+		}
+		if !closeVec(box.Center, vec3.T{5, -3, 8}) {
+			t.Fatalf("Expected %s center at the box's, got %v", name, box.Center)
+		}
+
+		// Lined up with its box, the mesh is the box it started as
+		transform := box.Transform()
+		inverse := transform.Inverse()
+		aligned := BoxTriangles(inverse.ApplyMesh(&turned)...)
+		for axis := 0; axis < 3; axis++ {
+			size := aligned.UpperBound[axis] - aligned.LowerBound[axis]
+			if math.Abs(size-2*box.HalfExtents[axis]) > 1e-6 || math.Abs(aligned.LowerBound[axis]+box.HalfExtents[axis]) > 1e-6 {
+				t.Fatalf("Expected %s alignment to fit the box, got %v", name, aligned)
+			}
+		}
+	}
+
+	// The principal axes of a cross say little about its tightest box
+	cross := append(newBoxMesh(vec3.T{-5, -1, -1}, vec3.T{5, 1, 1}), newBoxMesh(vec3.T{-1, -3, -1}, vec3.T{1, 3, 1})...)
+	turned = place.ApplyMesh(&cross)
+	box := MinimalOrientedBox(&turned)
+	checkOrientedBox(t, box, turned)
+	if volume := box.Volume(); math.Abs(volume-10*6*2) > 1e-6 {
+		t.Fatalf("Expected the cross to fit a box of 120, got %v", volume)
+	}
+	if pca := OrientedBoxPCA(&turned); pca.Volume() < box.Volume()-1e-6 {
+		t.Fatalf("PCA found a smaller box than the minimal one, %v", pca.Volume())
+	}
+
+	// A flat square has a flat box
+	flat := ArrayBuffer{{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}, {{0, 0, 0}, {1, 1, 0}, {0, 1, 0}}}
+	if box := MinimalOrientedBox(&flat); box.Volume() != 0 {
+		t.Fatalf("Expected a flat box, got %v", box)
+	}
+	if box := MinimalOrientedBox(&ArrayBuffer{}); box != nil {
+		t.Fatalf("Expected no box, got %v", box)
+	}
+}
+
+func TestOrientedBoxIntersects(t *testing.T) {
+	unit := &OrientedBox{Axes: [3]vec3.T{vec3.UnitX, vec3.UnitY, vec3.UnitZ}, HalfExtents: vec3.T{1, 1, 1}}
+
+	// A diamond beside the corner of the box, inside its bounding box
+	diagonal := math.Sqrt2 / 2
+	diamond := &OrientedBox{
+		Center:      vec3.T{1.8, 1.8, 0},
+		Axes:        [3]vec3.T{{diagonal, diagonal, 0}, {-diagonal, diagonal, 0}, vec3.UnitZ},
+		HalfExtents: vec3.T{1, 1, 1},
+	}
+	if unit.Intersects(diamond) || diamond.Intersects(unit) {
+		t.Fatal("Expected the diamond to miss the box")
+	}
+
+	diamond.Center = vec3.T{1.6, 1.6, 0}
+	if !unit.Intersects(diamond) || !diamond.Intersects(unit) {
+		t.Fatal("Expected the diamond to hit the box")
+	}
+
+	// Ridge across ridge, where only their cross product separates them
+	spun, tilted := Rotation(vec3.UnitY, math.Pi/4), Rotation(vec3.UnitX, math.Pi/4)
+	ridge := &OrientedBox{Center: vec3.T{0, 0, 3}, HalfExtents: vec3.T{1, 1, 1}}
+	for i := range unit.Axes {
+		ridge.Axes[i] = tilted.ApplyVector(unit.Axes[i])
+		unit.Axes[i] = spun.ApplyVector(unit.Axes[i])
+	}
+	if unit.Intersects(ridge) || ridge.Intersects(unit) {
+		t.Fatal("Expected the ridges to miss")
+	}
+	ridge.Center = vec3.T{0, 0, 2.7}
+	if !unit.Intersects(ridge) || !ridge.Intersects(unit) {
+		t.Fatal("Expected the ridges to hit")
+	}
+}
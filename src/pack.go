@@ -0,0 +1,347 @@
+package mesh
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+var ErrDontFit = errors.New("Not all parts fit in the build volume")
+
+type PackMode int
+
+const (
+	// Parts stand side by side on the build plate, with silhouettes apart
+	PackFootprint PackMode = iota
+	// Parts also stack on top of each other, as in powder bed printers
+	PackStacked
+)
+
+// PackOptions controls how parts are arranged in the build volume. Lengths
+// are in model units.
+type PackOptions struct {
+	Mode PackMode
+	// Space kept between parts
+	Spacing float64
+	// Number of turns about z tried for each part, spread evenly over a full
+	// turn. Defaults to 1, keeping parts as they are.
+	Rotations int
+	// Size of the grid cells parts are rasterized to. Defaults to 1/128 of
+	// the longer side of the build plate.
+	Resolution float64
+}
+
+func (this *PackOptions) withDefaults(volume *Box) *PackOptions {
+	options := *this
+	if options.Rotations <= 0 {
+		options.Rotations = 1
+	}
+	if options.Resolution <= 0 {
+		size := vec3.Sub(&volume.UpperBound, &volume.LowerBound)
+		options.Resolution = math.Max(size[0], size[1]) / 128
+	}
+	return &options
+}
+
+// Pack arranges the meshes in the build volume without overlaps, largest
+// first, each as far down and then towards the lower y and x as it goes. It
+// returns a transform for each mesh, or nil and ErrDontFit for those that
+// find no room.
+func Pack(meshes []Mesh, volume *Box, options *PackOptions) ([]*Transform, error) {
+	options = options.withDefaults(volume)
+	packer := newPacker(volume, options)
+
+	parts := make([]ArrayBuffer, len(meshes))
+	sizes := make([]float64, len(meshes))
+	order := make([]int, len(meshes))
+	for i, mesh := range meshes {
+		parts[i].ConvertFrom(mesh)
+		order[i] = i
+		if len(parts[i]) > 0 {
+			box := BoxTriangles(parts[i]...)
+			size := vec3.Sub(&box.UpperBound, &box.LowerBound)
+			sizes[i] = size[0] * size[1]
+			if options.Mode == PackStacked {
+				sizes[i] *= size[2]
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sizes[order[i]] > sizes[order[j]]
+	})
+
+	var err error
+	result := make([]*Transform, len(meshes))
+	for _, i := range order {
+		if len(parts[i]) == 0 {
+			identity := IdentityTransform()
+			result[i] = &identity
+			continue
+		}
+		if result[i] = packer.place(parts[i]); result[i] == nil {
+			err = ErrDontFit
+		}
+	}
+	return result, err
+}
+
+// span is the range of heights a part covers over one cell.
+type span struct {
+	lower, upper float64
+}
+
+// footprint is a part rasterized to the cells of the build plate, with its
+// lower corner at the origin.
+type footprint struct {
+	width, depth int
+	height       float64
+	spans        []span
+	transform    Transform
+}
+
+func newFootprint(abuf ArrayBuffer, rotation Transform, resolution float64) *footprint {
+	turned := abuf.transform(rotation.Apply)
+	box := BoxTriangles(turned...)
+	move := Translation(box.LowerBound.Inverted())
+
+	result := &footprint{
+		width:     cellCount(box.UpperBound[0]-box.LowerBound[0], resolution),
+		depth:     cellCount(box.UpperBound[1]-box.LowerBound[1], resolution),
+		height:    box.UpperBound[2] - box.LowerBound[2],
+		transform: rotation.Then(&move),
+	}
+	result.spans = make([]span, result.width*result.depth)
+	for i := range result.spans {
+		result.spans[i] = span{math.Inf(1), math.Inf(-1)}
+	}
+
+	for _, tri := range turned {
+		for i := range tri {
+			tri[i] = vec3.Sub(&tri[i], &box.LowerBound)
+		}
+		triBox := BoxTriangle(tri)
+		x0, x1 := cellRange(triBox.LowerBound[0], triBox.UpperBound[0], resolution, result.width)
+		y0, y1 := cellRange(triBox.LowerBound[1], triBox.UpperBound[1], resolution, result.depth)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				if !triangleOverlapsCell(tri, x, y, resolution) {
+					continue
+				}
+				cell := &result.spans[y*result.width+x]
+				cell.lower = math.Min(cell.lower, triBox.LowerBound[2])
+				cell.upper = math.Max(cell.upper, triBox.UpperBound[2])
+			}
+		}
+	}
+	return result
+}
+
+func cellCount(length, resolution float64) int {
+	return int(math.Max(1, math.Ceil(length/resolution-epsilon)))
+}
+
+func cellRange(lower, upper, resolution float64, count int) (int, int) {
+	return clampInt(int(math.Floor(lower/resolution)), 0, count-1),
+		clampInt(int(math.Floor(upper/resolution)), 0, count-1)
+}
+
+// triangleOverlapsCell reports whether the triangle, seen from above, covers
+// some of the cell rather than only touching it.
+func triangleOverlapsCell(tri Triangle, x, y int, resolution float64) bool {
+	corners := [4][2]float64{
+		{float64(x) * resolution, float64(y) * resolution},
+		{float64(x+1) * resolution, float64(y) * resolution},
+		{float64(x) * resolution, float64(y+1) * resolution},
+		{float64(x+1) * resolution, float64(y+1) * resolution},
+	}
+
+	// Separating axes are x, y and the normals of the edges
+	axes := [][2]float64{{1, 0}, {0, 1}}
+	for i := range tri {
+		next := tri[(i+1)%3]
+		axes = append(axes, [2]float64{next[1] - tri[i][1], tri[i][0] - next[0]})
+	}
+	for _, axis := range axes {
+		if axis == ([2]float64{}) {
+			continue
+		}
+		triLow, triHigh := math.Inf(1), math.Inf(-1)
+		for _, vert := range tri {
+			dot := vert[0]*axis[0] + vert[1]*axis[1]
+			triLow, triHigh = math.Min(triLow, dot), math.Max(triHigh, dot)
+		}
+		cellLow, cellHigh := math.Inf(1), math.Inf(-1)
+		for _, corner := range corners {
+			dot := corner[0]*axis[0] + corner[1]*axis[1]
+			cellLow, cellHigh = math.Min(cellLow, dot), math.Max(cellHigh, dot)
+		}
+		tolerance := epsilon * math.Hypot(axis[0], axis[1]) * resolution
+		if triHigh <= cellLow+tolerance || cellHigh <= triLow+tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// packer keeps the spans taken by the parts placed so far, grown by the
+// spacing, in each cell of the build plate.
+type packer struct {
+	volume  *Box
+	options *PackOptions
+	width   int
+	depth   int
+	taken   [][]span
+}
+
+func newPacker(volume *Box, options *PackOptions) *packer {
+	size := vec3.Sub(&volume.UpperBound, &volume.LowerBound)
+	result := &packer{
+		volume:  volume,
+		options: options,
+		width:   int(math.Floor(size[0]/options.Resolution + epsilon)),
+		depth:   int(math.Floor(size[1]/options.Resolution + epsilon)),
+	}
+	result.taken = make([][]span, result.width*result.depth)
+	return result
+}
+
+// place finds the lowest spot for the part over all rotations, and takes it.
+func (this *packer) place(abuf ArrayBuffer) *Transform {
+	var best *footprint
+	var bestX, bestY int
+	bestZ := math.Inf(1)
+
+	for r := 0; r < this.options.Rotations; r++ {
+		rotation := Rotation(vec3.UnitZ, 2*math.Pi*float64(r)/float64(this.options.Rotations))
+		part := newFootprint(abuf, rotation, this.options.Resolution)
+		x, y, z, ok := this.search(part)
+		if !ok {
+			continue
+		}
+		if best == nil || z < bestZ-epsilon || (z < bestZ+epsilon && (y < bestY || y == bestY && x < bestX)) {
+			best, bestX, bestY, bestZ = part, x, y, z
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	this.take(best, bestX, bestY, bestZ)
+	offset := vec3.T{
+		this.volume.LowerBound[0] + float64(bestX)*this.options.Resolution,
+		this.volume.LowerBound[1] + float64(bestY)*this.options.Resolution,
+		this.volume.LowerBound[2] + bestZ,
+	}
+	move := Translation(offset)
+	result := best.transform.Then(&move)
+	return &result
+}
+
+// search scans the plate by rows for the first spot where the part rests
+// lowest.
+func (this *packer) search(part *footprint) (x, y int, z float64, ok bool) {
+	top := this.volume.UpperBound[2] - this.volume.LowerBound[2]
+	if part.height > top+epsilon {
+		return 0, 0, 0, false
+	}
+
+	z = math.Inf(1)
+	for cy := 0; cy+part.depth <= this.depth; cy++ {
+		for cx := 0; cx+part.width <= this.width; cx++ {
+			if cz, fits := this.rest(part, cx, cy); fits && cz < z-epsilon {
+				x, y, z, ok = cx, cy, cz, true
+				if z == 0 {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// rest returns the lowest height the part fits at with its corner over the
+// given cell, lifting it over whatever it runs into.
+func (this *packer) rest(part *footprint, x, y int) (float64, bool) {
+	top := this.volume.UpperBound[2] - this.volume.LowerBound[2]
+	z := 0.0
+	for {
+		if z+part.height > top+epsilon {
+			return 0, false
+		}
+
+		lifted := z
+		for py := 0; py < part.depth; py++ {
+			for px := 0; px < part.width; px++ {
+				own := part.spans[py*part.width+px]
+				if own.lower > own.upper {
+					continue
+				}
+				for _, other := range this.taken[(y+py)*this.width+x+px] {
+					if z+own.lower < other.upper && other.lower < z+own.upper {
+						lifted = math.Max(lifted, other.upper-own.lower)
+					}
+				}
+			}
+		}
+		if lifted == z {
+			return z, true
+		}
+		z = lifted
+	}
+}
+
+// take marks the cells of the part at the given spot, grown by the spacing.
+// Side by side, the whole column of each cell is taken.
+func (this *packer) take(part *footprint, x, y int, z float64) {
+	spacing := this.options.Spacing
+	reach := int(math.Ceil(spacing/this.options.Resolution - epsilon))
+
+	grown := make(map[int]span)
+	for py := 0; py < part.depth; py++ {
+		for px := 0; px < part.width; px++ {
+			own := part.spans[py*part.width+px]
+			if own.lower > own.upper {
+				continue
+			}
+			cell := span{z + own.lower - spacing, z + own.upper + spacing}
+			if this.options.Mode == PackFootprint {
+				cell = span{math.Inf(-1), math.Inf(1)}
+			}
+
+			for dy := -reach; dy <= reach; dy++ {
+				for dx := -reach; dx <= reach; dx++ {
+					// Cells whose nearest corners are within the spacing
+					gapX := math.Max(0, float64(abs(dx)-1)) * this.options.Resolution
+					gapY := math.Max(0, float64(abs(dy)-1)) * this.options.Resolution
+					if math.Hypot(gapX, gapY) >= spacing && (dx != 0 || dy != 0) {
+						continue
+					}
+
+					cx, cy := x+px+dx, y+py+dy
+					if cx < 0 || cy < 0 || cx >= this.width || cy >= this.depth {
+						continue
+					}
+					index := cy*this.width + cx
+					if old, exists := grown[index]; exists {
+						grown[index] = span{math.Min(old.lower, cell.lower), math.Max(old.upper, cell.upper)}
+					} else {
+						grown[index] = cell
+					}
+				}
+			}
+		}
+	}
+
+	for index, cell := range grown {
+		this.taken[index] = append(this.taken[index], cell)
+	}
+}
+
+func abs(val int) int {
+	if val < 0 {
+		return -val
+	}
+	return val
+}
@@ -0,0 +1,121 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func packBoxes(t *testing.T, sizes []vec3.T, volume *Box, options *PackOptions) ([]*Box, error) {
+	meshes := make([]Mesh, len(sizes))
+	for i, size := range sizes {
+		abuf := newBoxMesh(vec3.T{-3, 7, 1}, vec3.Add(&vec3.T{-3, 7, 1}, &size))
+		meshes[i] = &abuf
+	}
+
+	transforms, err := Pack(meshes, volume, options)
+	boxes := make([]*Box, len(sizes))
+	for i, transform := range transforms {
+		if transform == nil {
+			continue
+		}
+		boxes[i] = BoxTriangles(transform.ApplyMesh(meshes[i])...)
+		for axis := 0; axis < 3; axis++ {
+			if boxes[i].LowerBound[axis] < volume.LowerBound[axis]-1e-9 || boxes[i].UpperBound[axis] > volume.UpperBound[axis]+1e-9 {
+				t.Fatalf("Part %d at %v is outside the build volume", i, boxes[i])
+			}
+		}
+	}
+	return boxes, err
+}
+
+// gap returns how far apart two boxes are, or a negative number if they
+// overlap.
+func gap(a, b *Box, axes int) float64 {
+	result := math.Inf(-1)
+	for axis := 0; axis < axes; axis++ {
+		result = math.Max(result, math.Max(a.LowerBound[axis]-b.UpperBound[axis], b.LowerBound[axis]-a.UpperBound[axis]))
+	}
+	return result
+}
+
+func TestPackFootprint(t *testing.T) {
+	plate := &Box{vec3.T{100, 0, -5}, vec3.T{125, 25, 20}}
+	options := &PackOptions{Spacing: 2, Resolution: 0.5}
+	sizes := []vec3.T{{10, 10, 5}, {11, 11, 3}, {10, 10, 20}, {10, 11, 2}}
+
+	boxes, err := packBoxes(t, sizes, plate, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, box := range boxes {
+		if math.Abs(box.LowerBound[2]-plate.LowerBound[2]) > 1e-9 {
+			t.Fatalf("Part %d isn't on the build plate", i)
+		}
+		for j := 0; j < i; j++ {
+			if d := gap(box, boxes[j], 2); d < options.Spacing-1e-9 {
+				t.Fatalf("Parts %d and %d are %v apart", i, j, d)
+			}
+		}
+	}
+
+	// The largest part goes in the corner
+	if box := boxes[1]; box.LowerBound != plate.LowerBound {
+		t.Fatalf("Expected the largest part in the corner, got %v", box.LowerBound)
+	}
+
+	boxes, err = packBoxes(t, append(sizes, vec3.T{5, 5, 5}), plate, options)
+	if err != ErrDontFit {
+		t.Fatalf("Expected ErrDontFit, got %v", err)
+	}
+	if boxes[4] != nil {
+		t.Fatalf("Expected the last part left out, got %v", boxes[4])
+	}
+}
+
+func TestPackRotations(t *testing.T) {
+	plate := &Box{vec3.T{0, 0, 0}, vec3.T{10, 30, 10}}
+	bar := []vec3.T{{20, 4, 4}}
+
+	if _, err := packBoxes(t, bar, plate, &PackOptions{Resolution: 1}); err != ErrDontFit {
+		t.Fatalf("Expected ErrDontFit, got %v", err)
+	}
+	boxes, err := packBoxes(t, bar, plate, &PackOptions{Resolution: 1, Rotations: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := vec3.Sub(&boxes[0].UpperBound, &boxes[0].LowerBound); math.Abs(size[1]-20) > 1e-9 {
+		t.Fatalf("Expected the bar turned along y, got %v", size)
+	}
+}
+
+func TestPackStacked(t *testing.T) {
+	volume := &Box{vec3.T{0, 0, 0}, vec3.T{21, 21, 21}}
+	options := &PackOptions{Mode: PackStacked, Spacing: 1, Resolution: 0.5}
+	sizes := make([]vec3.T, 8)
+	for i := range sizes {
+		sizes[i] = vec3.T{10, 10, 10}
+	}
+
+	boxes, err := packBoxes(t, sizes, volume, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers := map[float64]int{}
+	for i, box := range boxes {
+		layers[box.LowerBound[2]]++
+		for j := 0; j < i; j++ {
+			if d := gap(box, boxes[j], 3); d < options.Spacing-1e-9 {
+				t.Fatalf("Parts %d and %d are %v apart", i, j, d)
+			}
+		}
+	}
+	if layers[0] != 4 || layers[11] != 4 {
+		t.Fatalf("Expected two layers of four, got %v", layers)
+	}
+
+	if _, err := packBoxes(t, append(sizes, vec3.T{1, 1, 1}), volume, options); err != ErrDontFit {
+		t.Fatalf("Expected ErrDontFit, got %v", err)
+	}
+}
@@ -0,0 +1,485 @@
+package polygon
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+type ClipType int
+
+const (
+	ClipUnion ClipType = iota
+	ClipIntersection
+	ClipDifference // Subject minus clip
+	ClipXor
+)
+
+func (this ClipType) inside(subject, clip bool) bool {
+	switch this {
+	case ClipIntersection:
+		return subject && clip
+	case ClipDifference:
+		return subject && !clip
+	case ClipXor:
+		return subject != clip
+	}
+	return subject || clip
+}
+
+// Union returns the area inside either set of paths.
+func Union(subject, clip Paths, rule FillRule) Paths {
+	return Clip(ClipUnion, subject, clip, rule)
+}
+
+// Intersection returns the area inside both sets of paths.
+func Intersection(subject, clip Paths, rule FillRule) Paths {
+	return Clip(ClipIntersection, subject, clip, rule)
+}
+
+// Difference returns the area inside subject but not clip.
+func Difference(subject, clip Paths, rule FillRule) Paths {
+	return Clip(ClipDifference, subject, clip, rule)
+}
+
+// Xor returns the area inside exactly one of the sets of paths.
+func Xor(subject, clip Paths, rule FillRule) Paths {
+	return Clip(ClipXor, subject, clip, rule)
+}
+
+// Clip combines the areas that subject and clip each enclose under rule.
+// Every edge is split where it crosses another, and each piece is kept if the
+// result is inside on one side of it and outside on the other. The pieces are
+// then joined into loops, which are separated wherever they touch.
+func Clip(op ClipType, subject, clip Paths, rule FillRule) Paths {
+	edges := make([]inputEdge, 0)
+	for set, paths := range [2]Paths{subject, clip} {
+		for _, path := range paths {
+			for i := range path {
+				a, b := path[i], path[(i+1)%len(path)]
+				if a != b {
+					edges = append(edges, inputEdge{a: a, b: b, clip: set == 1})
+				}
+			}
+		}
+	}
+	if len(edges) == 0 {
+		return Paths{}
+	}
+
+	graph := newClipGraph(edges)
+	return graph.trace(func(windings [2]int) bool {
+		return op.inside(rule.inside(windings[0]), rule.inside(windings[1]))
+	})
+}
+
+type inputEdge struct {
+	a, b vec2.T
+	clip bool
+}
+
+// Relative to the size of the coordinates, how close points must be to merge
+const relativeTolerance = 1e-9
+
+func tolerance(edges []inputEdge) float64 {
+	var scale float64
+	for _, edge := range edges {
+		for _, pt := range [2]vec2.T{edge.a, edge.b} {
+			scale = math.Max(scale, math.Max(math.Abs(pt[0]), math.Abs(pt[1])))
+		}
+	}
+	return relativeTolerance * math.Max(1, scale)
+}
+
+type split struct {
+	t  float64
+	pt vec2.T
+}
+
+// splitEdges finds where the edges cross or touch and records the point on
+// both of them.
+func splitEdges(edges []inputEdge, tol float64) [][]split {
+	splits := make([][]split, len(edges))
+
+	order := make([]int, len(edges))
+	for i := range order {
+		order[i] = i
+	}
+	minX := func(i int) float64 {
+		return math.Min(edges[i].a[0], edges[i].b[0])
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return minX(order[i]) < minX(order[j])
+	})
+
+	addSplit := func(edge int, t float64, pt vec2.T) {
+		length := vec2.Distance(&edges[edge].a, &edges[edge].b)
+		if t*length > tol && (1-t)*length > tol {
+			splits[edge] = append(splits[edge], split{t, pt})
+		}
+	}
+
+	for oi, i := range order {
+		e1 := &edges[i]
+		maxX1 := math.Max(e1.a[0], e1.b[0])
+		minY1, maxY1 := math.Min(e1.a[1], e1.b[1]), math.Max(e1.a[1], e1.b[1])
+
+		for _, j := range order[oi+1:] {
+			if minX(j) > maxX1+tol {
+				break
+			}
+			e2 := &edges[j]
+			if math.Min(e2.a[1], e2.b[1]) > maxY1+tol || math.Max(e2.a[1], e2.b[1]) < minY1-tol {
+				continue
+			}
+
+			r, s := vec2.Sub(&e1.b, &e1.a), vec2.Sub(&e2.b, &e2.a)
+			offset := vec2.Sub(&e2.a, &e1.a)
+			denom := cross(r, s)
+			lenR, lenS := r.Length(), s.Length()
+
+			if math.Abs(denom) <= tol*(lenR+lenS) {
+				// Parallel, so only collinear overlaps matter
+				if math.Abs(cross(r, offset)) > tol*lenR {
+					continue
+				}
+				for _, pt := range [2]vec2.T{e2.a, e2.b} {
+					d := vec2.Sub(&pt, &e1.a)
+					if t := vec2.Dot(&d, &r) / (lenR * lenR); t > 0 && t < 1 {
+						addSplit(i, t, pt)
+					}
+				}
+				for _, pt := range [2]vec2.T{e1.a, e1.b} {
+					d := vec2.Sub(&pt, &e2.a)
+					if u := vec2.Dot(&d, &s) / (lenS * lenS); u > 0 && u < 1 {
+						addSplit(j, u, pt)
+					}
+				}
+				continue
+			}
+
+			t := cross(offset, s) / denom
+			u := cross(offset, r) / denom
+			if t < -tol/lenR || t > 1+tol/lenR || u < -tol/lenS || u > 1+tol/lenS {
+				continue
+			}
+
+			pt := vec2.T{e1.a[0] + t*r[0], e1.a[1] + t*r[1]}
+			addSplit(i, t, pt)
+			addSplit(j, u, pt)
+		}
+	}
+
+	return splits
+}
+
+func cross(a, b vec2.T) float64 {
+	return a[0]*b[1] - a[1]*b[0]
+}
+
+// vertexSet merges points closer than its tolerance.
+type vertexSet struct {
+	tol    float64
+	points []vec2.T
+	cells  map[[2]int64][]int
+}
+
+func (this *vertexSet) cell(pt vec2.T) [2]int64 {
+	return [2]int64{int64(math.Floor(pt[0] / this.tol)), int64(math.Floor(pt[1] / this.tol))}
+}
+
+func (this *vertexSet) add(pt vec2.T) int {
+	cell := this.cell(pt)
+	for dx := int64(-1); dx <= 1; dx++ {
+		for dy := int64(-1); dy <= 1; dy++ {
+			for _, i := range this.cells[[2]int64{cell[0] + dx, cell[1] + dy}] {
+				if math.Abs(this.points[i][0]-pt[0]) <= this.tol && math.Abs(this.points[i][1]-pt[1]) <= this.tol {
+					return i
+				}
+			}
+		}
+	}
+
+	index := len(this.points)
+	this.points = append(this.points, pt)
+	this.cells[cell] = append(this.cells[cell], index)
+	return index
+}
+
+// graphEdge is an edge between two vertices of the arrangement, from the
+// lower index to the higher. windings holds how much crossing it from right
+// to left changes the subject and clip winding numbers.
+type graphEdge struct {
+	from, to int
+	windings [2]int
+}
+
+type clipGraph struct {
+	vertices []vec2.T
+	edges    []*graphEdge
+	tol      float64
+}
+
+func newClipGraph(input []inputEdge) *clipGraph {
+	tol := tolerance(input)
+	splits := splitEdges(input, tol)
+	vertices := &vertexSet{tol: tol, cells: make(map[[2]int64][]int)}
+
+	byEnds := make(map[[2]int]*graphEdge)
+	graph := &clipGraph{tol: tol}
+	for i, edge := range input {
+		sort.Slice(splits[i], func(a, b int) bool {
+			return splits[i][a].t < splits[i][b].t
+		})
+
+		set := 0
+		if edge.clip {
+			set = 1
+		}
+
+		prev := vertices.add(edge.a)
+		points := append(splits[i], split{1, edge.b})
+		for _, next := range points {
+			index := vertices.add(next.pt)
+			if index == prev {
+				continue
+			}
+
+			from, to, dir := prev, index, 1
+			if from > to {
+				from, to, dir = to, from, -1
+			}
+			key := [2]int{from, to}
+			shared, exists := byEnds[key]
+			if !exists {
+				shared = &graphEdge{from: from, to: to}
+				byEnds[key] = shared
+				graph.edges = append(graph.edges, shared)
+			}
+			shared.windings[set] += dir
+
+			prev = index
+		}
+	}
+	graph.vertices = vertices.points
+
+	return graph
+}
+
+// rayIndex buckets edges by their extent along one axis, to find the edges
+// that a ray running along the other axis might cross.
+type rayIndex struct {
+	axis       int
+	lower      float64
+	bucketSize float64
+	buckets    [][]*graphEdge
+}
+
+func newRayIndex(graph *clipGraph, axis int) *rayIndex {
+	lower, upper := math.Inf(1), math.Inf(-1)
+	for _, pt := range graph.vertices {
+		lower = math.Min(lower, pt[axis])
+		upper = math.Max(upper, pt[axis])
+	}
+
+	numBuckets := int(math.Sqrt(float64(len(graph.edges)))) + 1
+	index := &rayIndex{
+		axis:       axis,
+		lower:      lower,
+		bucketSize: math.Max((upper-lower)/float64(numBuckets), graph.tol),
+		buckets:    make([][]*graphEdge, numBuckets),
+	}
+
+	for _, edge := range graph.edges {
+		if edge.windings == [2]int{} {
+			continue
+		}
+		a, b := graph.vertices[edge.from][axis], graph.vertices[edge.to][axis]
+		first, last := index.bucket(math.Min(a, b)), index.bucket(math.Max(a, b))
+		for i := first; i <= last; i++ {
+			index.buckets[i] = append(index.buckets[i], edge)
+		}
+	}
+
+	return index
+}
+
+func (this *rayIndex) bucket(val float64) int {
+	i := int((val - this.lower) / this.bucketSize)
+	if i < 0 {
+		return 0
+	}
+	if i >= len(this.buckets) {
+		return len(this.buckets) - 1
+	}
+	return i
+}
+
+// windings returns the winding numbers just beside pt, on the side the ray
+// runs to, counting crossings of a ray from pt along the positive direction
+// of the axis that isn't the index's. skip is left out.
+func (this *rayIndex) windings(graph *clipGraph, pt vec2.T, skip *graphEdge) [2]int {
+	along, across := 1-this.axis, this.axis
+
+	var windings [2]int
+	for _, edge := range this.buckets[this.bucket(pt[across])] {
+		if edge == skip {
+			continue
+		}
+
+		p0, p1 := graph.vertices[edge.from], graph.vertices[edge.to]
+		if (p0[across] > pt[across]) == (p1[across] > pt[across]) {
+			continue
+		}
+		hit := p0[along] + (pt[across]-p0[across])*(p1[along]-p0[along])/(p1[across]-p0[across])
+		if hit <= pt[along] {
+			continue
+		}
+
+		// Edges cross rays along x upwards and rays along y leftwards when
+		// the inside of a counter-clockwise loop is behind the ray's start
+		sign := 1
+		if (across == 1) != (p1[across] > p0[across]) {
+			sign = -1
+		}
+		windings[0] += sign * edge.windings[0]
+		windings[1] += sign * edge.windings[1]
+	}
+	return windings
+}
+
+type directedEdge struct {
+	from, to int
+}
+
+// trace returns the loops bounding the area where inside holds.
+func (this *clipGraph) trace(inside func(windings [2]int) bool) Paths {
+	// Rays along x for steep edges, along y for shallow ones
+	indices := [2]*rayIndex{newRayIndex(this, 1), newRayIndex(this, 0)}
+
+	kept := make([]directedEdge, 0)
+	outgoing := make(map[int][]int)
+	for _, edge := range this.edges {
+		if edge.windings == [2]int{} {
+			continue
+		}
+
+		a, b := this.vertices[edge.from], this.vertices[edge.to]
+		dir := vec2.Sub(&b, &a)
+		mid := vec2.T{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2}
+
+		var side vec2.T
+		var index *rayIndex
+		if math.Abs(dir[1]) >= math.Abs(dir[0]) {
+			side, index = vec2.T{1, 0}, indices[0]
+		} else {
+			side, index = vec2.T{0, 1}, indices[1]
+		}
+
+		beside := index.windings(this, mid, edge)
+		var left, right [2]int
+		for set := range beside {
+			if cross(dir, side) > 0 {
+				left[set] = beside[set]
+			} else {
+				left[set] = beside[set] + edge.windings[set]
+			}
+			right[set] = left[set] - edge.windings[set]
+		}
+
+		insideLeft, insideRight := inside(left), inside(right)
+		if insideLeft == insideRight {
+			continue
+		}
+
+		// Keep the inside on the left
+		directed := directedEdge{edge.from, edge.to}
+		if insideRight {
+			directed = directedEdge{edge.to, edge.from}
+		}
+		outgoing[directed.from] = append(outgoing[directed.from], len(kept))
+		kept = append(kept, directed)
+	}
+
+	used := make([]bool, len(kept))
+	result := make(Paths, 0)
+	for start := range kept {
+		if used[start] {
+			continue
+		}
+
+		path := make(Path, 0)
+		closed := false
+		for current := start; ; {
+			used[current] = true
+			path = append(path, this.vertices[kept[current].from])
+
+			next := this.nextEdge(kept, outgoing[kept[current].to], kept[current], used, start)
+			if next < 0 {
+				break
+			}
+			if next == start {
+				closed = true
+				break
+			}
+			current = next
+		}
+
+		if closed {
+			if path = this.clean(path); path != nil {
+				result = append(result, path)
+			}
+		}
+	}
+
+	return result
+}
+
+// nextEdge picks which of the candidate edges continues a loop arriving
+// along incoming: the first one clockwise from where it came from, which
+// keeps loops that touch at a vertex apart.
+func (this *clipGraph) nextEdge(kept []directedEdge, candidates []int, incoming directedEdge, used []bool, start int) int {
+	vertex := this.vertices[incoming.to]
+	back := vec2.Sub(&this.vertices[incoming.from], &vertex)
+	backAngle := math.Atan2(back[1], back[0])
+
+	best, bestAngle := -1, math.Inf(1)
+	for _, candidate := range candidates {
+		if used[candidate] && candidate != start {
+			continue
+		}
+
+		dir := vec2.Sub(&this.vertices[kept[candidate].to], &vertex)
+		angle := backAngle - math.Atan2(dir[1], dir[0])
+		for angle <= 0 {
+			angle += 2 * math.Pi
+		}
+		if angle < bestAngle {
+			best, bestAngle = candidate, angle
+		}
+	}
+	return best
+}
+
+// clean drops points in the middle of straight runs, and returns nil if
+// nothing is left of the path.
+func (this *clipGraph) clean(path Path) Path {
+	for changed := true; changed && len(path) >= 3; {
+		changed = false
+		for i := 0; i < len(path) && len(path) >= 3; i++ {
+			prev, next := path[(i+len(path)-1)%len(path)], path[(i+1)%len(path)]
+			d0, d1 := vec2.Sub(&path[i], &prev), vec2.Sub(&next, &path[i])
+			if math.Abs(cross(d0, d1)) <= this.tol*(d0.Length()+d1.Length()) {
+				path = append(path[:i], path[i+1:]...)
+				changed = true
+				i--
+			}
+		}
+	}
+
+	if len(path) < 3 || math.Abs(path.Area()) <= this.tol {
+		return nil
+	}
+	return path
+}
@@ -0,0 +1,147 @@
+package polygon
+
+import (
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+type JoinType int
+
+const (
+	// Sharp corners, squared off beyond MiterLimit
+	JoinMiter JoinType = iota
+	// Arcs around convex corners
+	JoinRound
+	// Corners cut off across their bisector at the offset distance
+	JoinSquare
+)
+
+const (
+	// How far a miter may reach, in multiples of the offset distance
+	MiterLimit = 2
+
+	// How far round joins may stray from a true arc, as a fraction of the
+	// offset distance
+	arcTolerance = 0.005
+)
+
+// Offset grows the area enclosed by the paths, under the NonZero rule, by
+// delta, or shrinks it if delta is negative. Outer loops must wind
+// counter-clockwise and holes clockwise, as Clip returns them. Parts that
+// shrink away vanish, and parts that grow into each other merge.
+func Offset(paths Paths, delta float64, join JoinType) Paths {
+	if delta == 0 {
+		return Union(paths, nil, NonZero)
+	}
+
+	raw := make(Paths, 0, len(paths))
+	for _, path := range paths {
+		if offset := offsetPath(path, delta, join); len(offset) >= 3 {
+			raw = append(raw, offset)
+		}
+	}
+
+	// Corners and collapsed parts of the raw offset wind the wrong way
+	return Union(raw, nil, Positive)
+}
+
+// offsetPath moves every edge of the path delta to its right and joins the
+// moved edges.
+func offsetPath(path Path, delta float64, join JoinType) Path {
+	points := make(Path, 0, len(path))
+	for i, pt := range path {
+		if pt != path[(i+1)%len(path)] {
+			points = append(points, pt)
+		}
+	}
+	n := len(points)
+	if n < 3 {
+		return nil
+	}
+
+	normals := make([]vec2.T, n)
+	directions := make([]vec2.T, n)
+	for i := range points {
+		dir := vec2.Sub(&points[(i+1)%n], &points[i])
+		dir.Normalize()
+		directions[i] = dir
+		normals[i] = vec2.T{dir[1], -dir[0]}
+	}
+
+	at := func(pt, normal vec2.T) vec2.T {
+		return vec2.T{pt[0] + normal[0]*delta, pt[1] + normal[1]*delta}
+	}
+
+	result := make(Path, 0, 2*n)
+	for i, pt := range points {
+		prev := (i + n - 1) % n
+		n0, n1 := normals[prev], normals[i]
+		sin, cos := cross(n0, n1), vec2.Dot(&n0, &n1)
+
+		if math.Abs(sin) < 1e-12 && cos > 0 {
+			// Straight on
+			result = append(result, at(pt, n0))
+			continue
+		}
+		if sin*delta < 0 {
+			// The moved edges overlap here; going back through the corner
+			// leaves a loop that Union removes
+			result = append(result, at(pt, n0), pt, at(pt, n1))
+			continue
+		}
+
+		switch join {
+		case JoinRound:
+			result = append(result, roundJoin(pt, n0, n1, delta)...)
+		case JoinMiter:
+			if 1+cos >= 2/(MiterLimit*MiterLimit) {
+				scale := delta / (1 + cos)
+				result = append(result, vec2.T{pt[0] + (n0[0]+n1[0])*scale, pt[1] + (n0[1]+n1[1])*scale})
+				break
+			}
+			fallthrough
+		default:
+			result = append(result, squareJoin(pt, n0, n1, directions[prev], directions[i], delta)...)
+		}
+	}
+
+	return result
+}
+
+// roundJoin returns an arc of radius |delta| around pt from n0 to n1.
+func roundJoin(pt, n0, n1 vec2.T, delta float64) []vec2.T {
+	angle := math.Atan2(cross(n0, n1), vec2.Dot(&n0, &n1))
+	maxStep := 2 * math.Acos(1-arcTolerance)
+	steps := int(math.Ceil(math.Abs(angle) / maxStep))
+
+	start := math.Atan2(n0[1], n0[0])
+	result := make([]vec2.T, 0, steps+1)
+	for i := 0; i <= steps; i++ {
+		a := start + angle*float64(i)/float64(steps)
+		result = append(result, vec2.T{pt[0] + math.Cos(a)*delta, pt[1] + math.Sin(a)*delta})
+	}
+	return result
+}
+
+// squareJoin cuts the corner off across its bisector, delta from pt.
+func squareJoin(pt, n0, n1, dir0, dir1 vec2.T, delta float64) []vec2.T {
+	bisector := vec2.Add(&n0, &n1)
+	if bisector.Length() < 1e-12 {
+		// The path turns straight back, so cap it beyond the tip
+		bisector = dir0
+		if delta < 0 {
+			bisector.Scale(-1)
+		}
+	} else {
+		bisector.Normalize()
+	}
+
+	// Where each moved edge meets the cut
+	t0 := delta * (1 - vec2.Dot(&n0, &bisector)) / vec2.Dot(&dir0, &bisector)
+	t1 := delta * (1 - vec2.Dot(&n1, &bisector)) / vec2.Dot(&dir1, &bisector)
+	return []vec2.T{
+		{pt[0] + n0[0]*delta + dir0[0]*t0, pt[1] + n0[1]*delta + dir0[1]*t0},
+		{pt[0] + n1[0]*delta + dir1[0]*t1, pt[1] + n1[1]*delta + dir1[1]*t1},
+	}
+}
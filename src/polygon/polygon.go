@@ -0,0 +1,112 @@
+// Package polygon offsets and clips 2D polygons, with the semantics of the
+// Clipper library: results are simple loops whose inside is on their left,
+// so outer loops wind counter-clockwise and holes clockwise.
+package polygon
+
+import (
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+// Path is a closed polygon. The last point connects back to the first.
+type Path []vec2.T
+
+type Paths []Path
+
+// FillRule decides which winding numbers count as inside.
+type FillRule int
+
+const (
+	EvenOdd FillRule = iota
+	NonZero
+	Positive
+	Negative
+)
+
+func (this FillRule) inside(winding int) bool {
+	switch this {
+	case NonZero:
+		return winding != 0
+	case Positive:
+		return winding > 0
+	case Negative:
+		return winding < 0
+	}
+	return winding%2 != 0
+}
+
+// Area returns the signed area of the path: positive if it winds
+// counter-clockwise.
+func (this Path) Area() float64 {
+	var area float64
+	for i := range this {
+		p0, p1 := this[i], this[(i+1)%len(this)]
+		area += p0[0]*p1[1] - p1[0]*p0[1]
+	}
+	return area / 2
+}
+
+// Reversed returns the path running the other way.
+func (this Path) Reversed() Path {
+	result := make(Path, len(this))
+	for i, pt := range this {
+		result[len(this)-1-i] = pt
+	}
+	return result
+}
+
+// Winding returns the winding number of the path around pt.
+func (this Path) Winding(pt vec2.T) int {
+	var winding int
+	for i := range this {
+		p0, p1 := this[i], this[(i+1)%len(this)]
+		if (p0[1] > pt[1]) == (p1[1] > pt[1]) {
+			continue
+		}
+
+		x := p0[0] + (pt[1]-p0[1])*(p1[0]-p0[0])/(p1[1]-p0[1])
+		if x > pt[0] {
+			if p1[1] > p0[1] {
+				winding++
+			} else {
+				winding--
+			}
+		}
+	}
+	return winding
+}
+
+// Area returns the total signed area of the paths, so holes count against
+// their outer loops.
+func (this Paths) Area() float64 {
+	var area float64
+	for _, path := range this {
+		area += path.Area()
+	}
+	return area
+}
+
+// Contains reports whether pt is inside the paths under rule.
+func (this Paths) Contains(pt vec2.T, rule FillRule) bool {
+	var winding int
+	for _, path := range this {
+		winding += path.Winding(pt)
+	}
+	return rule.inside(winding)
+}
+
+// Bounds returns the lower and upper corners of the box around the paths.
+func (this Paths) Bounds() (lower, upper vec2.T) {
+	lower = vec2.T{math.Inf(1), math.Inf(1)}
+	upper = vec2.T{math.Inf(-1), math.Inf(-1)}
+	for _, path := range this {
+		for _, pt := range path {
+			for i := range pt {
+				lower[i] = math.Min(lower[i], pt[i])
+				upper[i] = math.Max(upper[i], pt[i])
+			}
+		}
+	}
+	return lower, upper
+}
@@ -0,0 +1,129 @@
+package polygon
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+func rect(x0, y0, x1, y1 float64) Path {
+	return Path{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+}
+
+func checkArea(t *testing.T, name string, paths Paths, numPaths int, area float64) {
+	if len(paths) != numPaths || math.Abs(paths.Area()-area) > 1e-6 {
+		t.Errorf("%s: expected %d paths with area %v, got %d with area %v: %v",
+			name, numPaths, area, len(paths), paths.Area(), paths)
+	}
+}
+
+func TestClip(t *testing.T) {
+	a, b := Paths{rect(0, 0, 2, 2)}, Paths{rect(1, 1, 3, 3)}
+
+	union := Union(a, b, NonZero)
+	checkArea(t, "union", union, 1, 7)
+	if len(union) == 1 && len(union[0]) != 8 {
+		t.Errorf("Union should have 8 corners, got %v", union[0])
+	}
+	checkArea(t, "intersection", Intersection(a, b, NonZero), 1, 1)
+	checkArea(t, "difference", Difference(a, b, NonZero), 1, 3)
+	checkArea(t, "xor", Xor(a, b, NonZero), 2, 6)
+
+	// Overlaps cancel under even-odd
+	checkArea(t, "even-odd", Union(Paths{rect(0, 0, 2, 2), rect(1, 1, 3, 3)}, nil, EvenOdd), 2, 6)
+
+	// Squares sharing an edge merge into one rectangle
+	merged := Union(Paths{rect(0, 0, 1, 1)}, Paths{rect(1, 0, 2, 1)}, NonZero)
+	checkArea(t, "shared edge", merged, 1, 2)
+	if len(merged) == 1 && len(merged[0]) != 4 {
+		t.Errorf("Shared edge should disappear, got %v", merged[0])
+	}
+
+	// Squares touching at a corner stay apart
+	checkArea(t, "touching", Union(Paths{rect(0, 0, 1, 1)}, Paths{rect(1, 1, 2, 2)}, NonZero), 2, 2)
+
+	// A clockwise hole
+	withHole := Union(Paths{rect(0, 0, 10, 10), rect(2, 2, 8, 8).Reversed()}, nil, NonZero)
+	checkArea(t, "hole", withHole, 2, 64)
+	for _, path := range withHole {
+		hole := path.Area() < 0
+		if hole != (math.Abs(path.Area()) < 50) {
+			t.Errorf("Wrong orientation for %v", path)
+		}
+	}
+	if withHole.Contains(vec2.T{5, 5}, NonZero) || !withHole.Contains(vec2.T{1, 5}, NonZero) {
+		t.Error("Hole contains the wrong points")
+	}
+
+	// Positive drops the reversed square
+	checkArea(t, "positive", Union(Paths{rect(0, 0, 1, 1), rect(2, 0, 3, 1).Reversed()}, nil, Positive), 1, 1)
+
+	checkArea(t, "empty", Intersection(a, Paths{rect(5, 5, 6, 6)}, NonZero), 0, 0)
+}
+
+func TestOffset(t *testing.T) {
+	square := Paths{rect(0, 0, 10, 10)}
+
+	checkArea(t, "miter", Offset(square, 1, JoinMiter), 1, 144)
+	checkArea(t, "square", Offset(square, 1, JoinSquare), 1, 144-2*(2-math.Sqrt2)*(2-math.Sqrt2))
+	round := Offset(square, 1, JoinRound)
+	if len(round) != 1 || math.Abs(round.Area()-(140+math.Pi)) > 0.05 {
+		t.Errorf("Round offset has area %v, expected about %v", round.Area(), 140+math.Pi)
+	}
+
+	checkArea(t, "shrink", Offset(square, -1, JoinMiter), 1, 64)
+	checkArea(t, "vanish", Offset(square, -6, JoinRound), 0, 0)
+
+	withHole := Paths{rect(0, 0, 10, 10), rect(3, 3, 7, 7).Reversed()}
+	checkArea(t, "hole grows", Offset(withHole, -1, JoinMiter), 2, 64-36)
+	checkArea(t, "hole closes", Offset(withHole, 2.5, JoinMiter), 1, 225)
+
+	// Islands merge when they grow into each other
+	islands := Paths{rect(0, 0, 1, 1), rect(1.5, 0, 2.5, 1)}
+	checkArea(t, "merge", Offset(islands, 0.5, JoinMiter), 1, 3.5*2)
+
+	// A concave L keeps its inner corner sharp when grown
+	l := Paths{{{0, 0}, {2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}}}
+	checkArea(t, "concave", Offset(l, 0.25, JoinMiter), 1, 2.5*1.5+1.5*1)
+}
+
+func TestUnionRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 20; trial++ {
+		var covered [20][20]bool
+		paths := make(Paths, 0)
+		for i := 0; i < 8; i++ {
+			x0, y0 := rng.Intn(15), rng.Intn(15)
+			x1, y1 := x0+1+rng.Intn(5), y0+1+rng.Intn(5)
+			paths = append(paths, rect(float64(x0), float64(y0), float64(x1), float64(y1)))
+			for x := x0; x < x1; x++ {
+				for y := y0; y < y1; y++ {
+					covered[x][y] = true
+				}
+			}
+		}
+
+		var area float64
+		for x := range covered {
+			for y := range covered[x] {
+				if covered[x][y] {
+					area++
+				}
+			}
+		}
+
+		union := Union(paths, nil, NonZero)
+		if math.Abs(union.Area()-area) > 1e-9 {
+			t.Fatalf("Trial %d: union has area %v, expected %v", trial, union.Area(), area)
+		}
+		for x := range covered {
+			for y := range covered[x] {
+				if union.Contains(vec2.T{float64(x) + 0.5, float64(y) + 0.5}, NonZero) != covered[x][y] {
+					t.Fatalf("Trial %d: cell %d, %d misclassified", trial, x, y)
+				}
+			}
+		}
+	}
+}
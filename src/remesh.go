@@ -0,0 +1,194 @@
+package mesh
+
+import "github.com/ungerik/go3d/float64/vec3"
+
+// Rounds of splitting, collapsing, flipping and relaxing
+const remeshIterations = 10
+
+// Remesh rebuilds the surface of the mesh out of well shaped triangles with
+// edges close to the target length, after Botsch and Kobbelt. Each round
+// splits long edges, collapses short ones, flips edges to even out the
+// number of edges at each vertex, and slides vertices along the surface to
+// even out their spacing, then puts them back on the original surface. Open
+// edges keep their vertices and are only split. Sharp edges aren't kept
+// sharp, so corners come out slightly rounded.
+func Remesh(mesh Mesh, targetEdgeLength float64) *IndexBuffer {
+	ibuf := &IndexBuffer{}
+	ibuf.ConvertFrom(mesh)
+	if targetEdgeLength <= 0 || len(ibuf.Faces) == 0 {
+		return ibuf
+	}
+
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	tree := NewOctree(sdfOctreeLevels, BoxTriangles(abuf...).ExpandToCube())
+	for _, tri := range abuf {
+		tree.Insert(NewBoxedTriangle(tri))
+	}
+
+	remesher := &remesher{
+		editMesh: newEditMesh(ibuf),
+		surface:  tree,
+		high:     targetEdgeLength * 4 / 3,
+		low:      targetEdgeLength * 4 / 5,
+	}
+	for i := 0; i < remeshIterations; i++ {
+		remesher.splitLong()
+		remesher.collapseShort()
+		remesher.equalizeValences()
+		remesher.relax()
+	}
+	return remesher.result()
+}
+
+type remesher struct {
+	*editMesh
+	surface   *Octree
+	high, low float64
+}
+
+func (this *remesher) length(a, b int) float64 {
+	return vec3.Distance(&this.verts[a], &this.verts[b])
+}
+
+func (this *remesher) splitLong() {
+	for split := true; split; {
+		split = false
+		for _, edge := range this.edges() {
+			a, b := edge[0], edge[1]
+			if this.length(a, b) > this.high {
+				this.split(a, b, vec3.Interpolate(&this.verts[a], &this.verts[b], 0.5))
+				split = true
+			}
+		}
+	}
+}
+
+func (this *remesher) collapseShort() {
+	for _, edge := range this.edges() {
+		a, b := edge[0], edge[1]
+		if this.merged[a] || this.merged[b] || this.length(a, b) >= this.low {
+			continue
+		}
+
+		// Open edges keep their vertices
+		var target vec3.T
+		switch {
+		case this.boundary[a] && this.boundary[b]:
+			continue
+		case this.boundary[a]:
+			a, b = b, a
+			target = this.verts[b]
+		case this.boundary[b]:
+			target = this.verts[b]
+		default:
+			target = vec3.Interpolate(&this.verts[a], &this.verts[b], 0.5)
+		}
+
+		// Collapses that make long edges would only be split again
+		long := false
+		for _, end := range []int{a, b} {
+			for _, vert := range this.neighbors(end) {
+				if vert != a && vert != b && vec3.Distance(&target, &this.verts[vert]) > this.high {
+					long = true
+				}
+			}
+		}
+		if long || !this.canCollapse(a, b, target) {
+			continue
+		}
+		this.collapse(a, b, target)
+	}
+}
+
+// valence returns the number of edges at a vertex, which on a manifold is
+// one more than its faces on an open edge.
+func (this *remesher) valence(vert int) int {
+	if this.boundary[vert] {
+		return len(this.around[vert]) + 1
+	}
+	return len(this.around[vert])
+}
+
+// valenceDeviation returns how far the number of edges at each vertex is
+// from ideal, which is 6 inside and 4 on open edges, if the edges there
+// changed by the given amounts.
+func (this *remesher) valenceDeviation(verts [4]int, changes [4]int) int {
+	var result int
+	for i, vert := range verts {
+		ideal := 6
+		if this.boundary[vert] {
+			ideal = 4
+		}
+		off := this.valence(vert) + changes[i] - ideal
+		result += off * off
+	}
+	return result
+}
+
+func (this *remesher) equalizeValences() {
+	for _, edge := range this.edges() {
+		a, b := edge[0], edge[1]
+		faces := this.edgeFaces(a, b)
+		if len(faces) != 2 {
+			continue
+		}
+		c, ok := this.third(faces[0], a, b)
+		if !ok {
+			c, _ = this.third(faces[1], a, b)
+		}
+		d, ok := this.third(faces[0], b, a)
+		if !ok {
+			d, _ = this.third(faces[1], b, a)
+		}
+		if this.valence(a) <= 3 || this.valence(b) <= 3 {
+			continue
+		}
+
+		verts := [4]int{a, b, c, d}
+		before := this.valenceDeviation(verts, [4]int{})
+		after := this.valenceDeviation(verts, [4]int{-1, -1, 1, 1})
+		if after < before {
+			this.flip(a, b)
+		}
+	}
+}
+
+// relax moves each inside vertex towards the middle of its neighbors, only
+// along the surface, and then back onto the original surface.
+func (this *remesher) relax() {
+	moved := make([]vec3.T, len(this.verts))
+	copy(moved, this.verts)
+	for vert := range this.verts {
+		if this.merged[vert] || this.boundary[vert] || len(this.around[vert]) == 0 {
+			continue
+		}
+
+		var normal vec3.T
+		for _, i := range this.around[vert] {
+			faceNormal := this.triangle(this.faces[i]).Plane().Normal
+			normal.Add(&faceNormal)
+		}
+		if normal.Length() == 0 {
+			continue
+		}
+		normal.Normalize()
+
+		var middle vec3.T
+		neighbors := this.neighbors(vert)
+		for _, other := range neighbors {
+			middle.Add(&this.verts[other])
+		}
+		middle.Scale(1 / float64(len(neighbors)))
+
+		// Drop the part of the move along the normal
+		offset := vec3.Sub(&this.verts[vert], &middle)
+		along := normal.Scaled(vec3.Dot(&offset, &normal))
+		target := vec3.Add(&middle, &along)
+		if closest, ok := this.surface.Nearest(target); ok {
+			target = closest
+		}
+		moved[vert] = target
+	}
+	this.verts = moved
+}
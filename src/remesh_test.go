@@ -0,0 +1,79 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// minAngle returns the smallest angle of the triangle in degrees.
+func minAngle(tri Triangle) float64 {
+	result := math.Inf(1)
+	for i := range tri {
+		a := vec3.Sub(&tri[(i+1)%3], &tri[i])
+		b := vec3.Sub(&tri[(i+2)%3], &tri[i])
+		cos := vec3.Dot(&a, &b) / (a.Length() * b.Length())
+		result = math.Min(result, math.Acos(math.Max(-1, math.Min(1, cos)))*180/math.Pi)
+	}
+	return result
+}
+
+// checkRemesh fails unless most triangles are well shaped and most edges
+// are near the target length.
+func checkRemesh(t *testing.T, ibuf *IndexBuffer, target float64) {
+	angles := make([]float64, len(ibuf.Faces))
+	lengths := make([]float64, 0, len(ibuf.Faces)*3)
+	for i, face := range ibuf.Faces {
+		tri := Triangle{ibuf.Vertices[face[0]], ibuf.Vertices[face[1]], ibuf.Vertices[face[2]]}
+		angles[i] = minAngle(tri)
+		for j := range tri {
+			lengths = append(lengths, vec3.Distance(&tri[j], &tri[(j+1)%3]))
+		}
+	}
+	sort.Float64s(angles)
+	sort.Float64s(lengths)
+
+	if low := angles[len(angles)/10]; low < 30 {
+		t.Fatalf("Expected 90%% of triangles to have angles over 30°, got %v", low)
+	}
+	if low, high := lengths[len(lengths)/20], lengths[len(lengths)*19/20]; low < target/2 || high > target*1.5 {
+		t.Fatalf("Expected 90%% of edges near %v, got %v to %v", target, low, high)
+	}
+}
+
+func TestRemesh(t *testing.T) {
+	// Twelve long slivers
+	bar := newBoxMesh(vec3.T{0, 0, 0}, vec3.T{10, 1, 1})
+	result := Remesh(&bar, 0.2)
+	checkManifold(t, result, true)
+	checkRemesh(t, result, 0.2)
+	for _, vert := range result.Vertices {
+		inside := math.Min(math.Min(vert[0], 10-vert[0]), math.Min(math.Min(vert[1], 1-vert[1]), math.Min(vert[2], 1-vert[2])))
+		if math.Abs(inside) > 1e-9 {
+			t.Fatalf("Vertex %v is off the surface", vert)
+		}
+	}
+	if volume := Volume(result); volume > 10+1e-9 || volume < 9.6 {
+		t.Fatalf("Expected volume near 10, got %v", volume)
+	}
+
+	// Open edges keep their place
+	plane := newGridPlane(1)
+	result = Remesh(plane, 0.1)
+	checkManifold(t, result, false)
+	checkRemesh(t, result, 0.1)
+	if area := Area(result); math.Abs(area-1) > 1e-9 {
+		t.Fatalf("Expected area 1, got %v", area)
+	}
+	for _, vert := range result.Vertices {
+		if vert[2] != 1 {
+			t.Fatalf("Vertex %v left the plane", vert)
+		}
+	}
+
+	if same := Remesh(plane, 0); len(same.Faces) != 2 {
+		t.Fatalf("Expected no change, got %d triangles", len(same.Faces))
+	}
+}
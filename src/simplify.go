@@ -0,0 +1,280 @@
+package mesh
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// SimplifyOptions controls mesh decimation. Simplify stops at whichever limit
+// it reaches first, and a zero limit is no limit.
+type SimplifyOptions struct {
+	// Number of triangles to bring the mesh down to
+	TargetTriangles int
+	// Largest error of a collapse, in model units, measured as the root of
+	// the summed squared distances to the planes of the faces it replaces
+	MaxError float64
+	// Keep vertices on sharp edges in place
+	LockSharp bool
+	// Edges whose faces turn by more than this, in degrees, are sharp.
+	// Defaults to 60.
+	SharpAngle float64
+}
+
+func (this *SimplifyOptions) withDefaults() *SimplifyOptions {
+	options := *this
+	if options.SharpAngle <= 0 {
+		options.SharpAngle = 60
+	}
+	return &options
+}
+
+// How much more moving off an open edge counts than moving off a face
+const boundaryWeight = 1e3
+
+// Simplify decimates the mesh by edge collapse, cheapest first by the
+// quadric error metric of Garland and Heckbert. Open edges keep their shape,
+// and collapses that would turn faces over or pinch the surface aren't made.
+func Simplify(mesh Mesh, options *SimplifyOptions) *IndexBuffer {
+	ibuf := &IndexBuffer{}
+	ibuf.ConvertFrom(mesh)
+	options = options.withDefaults()
+	if options.TargetTriangles <= 0 && options.MaxError <= 0 {
+		return ibuf
+	}
+
+	simplifier := newSimplifier(ibuf, options)
+	simplifier.run()
+	return simplifier.result()
+}
+
+// quadric is the symmetric matrix of a sum of squared distances to planes,
+// upper triangle first.
+type quadric [10]float64
+
+func planeQuadric(normal vec3.T, offset, weight float64) quadric {
+	a, b, c, d := normal[0], normal[1], normal[2], offset
+	return quadric{
+		a * a, a * b, a * c, a * d,
+		b * b, b * c, b * d,
+		c * c, c * d,
+		d * d,
+	}.scaled(weight)
+}
+
+func (this quadric) scaled(weight float64) quadric {
+	for i := range this {
+		this[i] *= weight
+	}
+	return this
+}
+
+func (this *quadric) add(other *quadric) {
+	for i := range this {
+		this[i] += other[i]
+	}
+}
+
+func (this *quadric) error(pt vec3.T) float64 {
+	x, y, z := pt[0], pt[1], pt[2]
+	q := this
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+// minimum returns the point of least error, if there is just one.
+func (this *quadric) minimum() (vec3.T, bool) {
+	q := this
+	a := [3][3]float64{{q[0], q[1], q[2]}, {q[1], q[4], q[5]}, {q[2], q[5], q[7]}}
+	det := a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+	scale := q[0] + q[4] + q[7]
+	if math.Abs(det) <= 1e-9*scale*scale*scale {
+		return vec3.T{}, false
+	}
+
+	transform := Transform{Linear: a}
+	inverse := transform.Inverse()
+	result := inverse.ApplyVector(vec3.T{-q[3], -q[6], -q[8]})
+	return result, true
+}
+
+type collapse struct {
+	from, to int // from merges into to
+	target   vec3.T
+	cost     float64
+	versions [2]int
+	index    int
+}
+
+type collapseQueue []*collapse
+
+func (this collapseQueue) Len() int           { return len(this) }
+func (this collapseQueue) Less(i, j int) bool { return this[i].cost < this[j].cost }
+func (this collapseQueue) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+	this[i].index, this[j].index = i, j
+}
+func (this *collapseQueue) Push(x interface{}) {
+	item := x.(*collapse)
+	item.index = len(*this)
+	*this = append(*this, item)
+}
+func (this *collapseQueue) Pop() interface{} {
+	old := *this
+	item := old[len(old)-1]
+	*this = old[:len(old)-1]
+	return item
+}
+
+type simplifier struct {
+	*editMesh
+	options  *SimplifyOptions
+	quadrics []quadric
+	versions []int
+	locked   []bool
+	queue    collapseQueue
+}
+
+func newSimplifier(ibuf *IndexBuffer, options *SimplifyOptions) *simplifier {
+	count := len(ibuf.Vertices)
+	this := &simplifier{
+		editMesh: newEditMesh(ibuf),
+		options:  options,
+		quadrics: make([]quadric, count),
+		versions: make([]int, count),
+		locked:   make([]bool, count),
+	}
+
+	edges := make(map[[2]uint32][]int)
+	for i, face := range this.faces {
+		tri := this.triangle(face)
+		normal := tri.Normal()
+		plane := planeQuadric(normal, -vec3.Dot(&normal, &tri[0]), 1)
+		for j, vert := range face {
+			this.quadrics[vert].add(&plane)
+			key := edgeKey(vert, face[(j+1)%3])
+			edges[key] = append(edges[key], i)
+		}
+	}
+
+	sharp := math.Cos(options.SharpAngle * math.Pi / 180)
+	for edge, faces := range edges {
+		if len(faces) == 1 {
+			// A plane square to the face along the edge holds it in place
+			a, b := this.verts[edge[0]], this.verts[edge[1]]
+			along := vec3.Sub(&b, &a)
+			normal := this.triangle(this.faces[faces[0]]).Normal()
+			side := vec3.Cross(&along, &normal)
+			if side.Length() == 0 {
+				continue
+			}
+			side.Normalize()
+			plane := planeQuadric(side, -vec3.Dot(&side, &a), boundaryWeight)
+			for _, vert := range edge {
+				this.quadrics[vert].add(&plane)
+			}
+		} else if options.LockSharp && len(faces) == 2 {
+			n0 := this.triangle(this.faces[faces[0]]).Normal()
+			n1 := this.triangle(this.faces[faces[1]]).Normal()
+			if vec3.Dot(&n0, &n1) < sharp {
+				this.locked[edge[0]], this.locked[edge[1]] = true, true
+			}
+		}
+	}
+
+	for vert := range this.verts {
+		this.queueEdges(vert)
+	}
+	return this
+}
+
+func (this *simplifier) queueEdges(vert int) {
+	for _, other := range this.neighbors(vert) {
+		// At the start, each edge is queued from its lower end
+		if other < vert && this.versions[vert] == 0 && this.versions[other] == 0 {
+			continue
+		}
+		if item := this.plan(vert, other); item != nil {
+			heap.Push(&this.queue, item)
+		}
+	}
+}
+
+// plan picks where to put the vertices of an edge once they are merged, or
+// returns nil if they can't be.
+func (this *simplifier) plan(a, b int) *collapse {
+	if this.locked[a] && this.locked[b] {
+		return nil
+	}
+
+	var total quadric
+	total.add(&this.quadrics[a])
+	total.add(&this.quadrics[b])
+
+	// Locked vertices and those on an open edge stay where they are, when
+	// the other isn't
+	var candidates []vec3.T
+	switch {
+	case this.locked[a] || this.boundary[a] && !this.boundary[b]:
+		candidates = []vec3.T{this.verts[a]}
+	case this.locked[b] || this.boundary[b] && !this.boundary[a]:
+		candidates = []vec3.T{this.verts[b]}
+	default:
+		mid := vec3.Interpolate(&this.verts[a], &this.verts[b], 0.5)
+		candidates = []vec3.T{this.verts[a], this.verts[b], mid}
+		if best, ok := total.minimum(); ok {
+			candidates = append(candidates, best)
+		}
+	}
+
+	item := &collapse{from: a, to: b, cost: math.Inf(1), versions: [2]int{this.versions[a], this.versions[b]}}
+	for _, target := range candidates {
+		if cost := total.error(target); cost < item.cost {
+			item.target, item.cost = target, cost
+		}
+	}
+	return item
+}
+
+func (this *simplifier) run() {
+	heap.Init(&this.queue)
+	maxCost := this.options.MaxError * this.options.MaxError
+	for this.queue.Len() > 0 {
+		if this.options.TargetTriangles > 0 && this.liveFaces <= this.options.TargetTriangles {
+			return
+		}
+
+		item := heap.Pop(&this.queue).(*collapse)
+		if this.merged[item.from] || this.merged[item.to] ||
+			item.versions != [2]int{this.versions[item.from], this.versions[item.to]} {
+			continue
+		}
+		if this.options.MaxError > 0 && item.cost > maxCost {
+			return
+		}
+		if !this.canCollapse(item.from, item.to, item.target) {
+			continue
+		}
+		this.collapse(item)
+	}
+}
+
+func (this *simplifier) collapse(item *collapse) {
+	from, to := item.from, item.to
+	this.quadrics[to].add(&this.quadrics[from])
+	this.locked[to] = this.locked[to] || this.locked[from]
+	this.versions[to]++
+	this.editMesh.collapse(from, to, item.target)
+
+	for _, vert := range this.neighbors(to) {
+		this.versions[vert]++
+	}
+	for _, vert := range append(this.neighbors(to), to) {
+		this.queueEdges(vert)
+	}
+}
@@ -0,0 +1,162 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// newGridBox returns a unit cube with each side split into n by n squares.
+func newGridBox(n int) *IndexBuffer {
+	abuf := ArrayBuffer{}
+	for axis := 0; axis < 3; axis++ {
+		u, v := (axis+1)%3, (axis+2)%3
+		for side := 0; side < 2; side++ {
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					var quad [4]vec3.T
+					for k, corner := range [4][2]int{{i, j}, {i + 1, j}, {i + 1, j + 1}, {i, j + 1}} {
+						quad[k][axis] = float64(side)
+						quad[k][u] = float64(corner[0]) / float64(n)
+						quad[k][v] = float64(corner[1]) / float64(n)
+					}
+					if side == 0 {
+						quad[1], quad[3] = quad[3], quad[1]
+					}
+					abuf = append(abuf, Triangle{quad[0], quad[1], quad[2]}, Triangle{quad[0], quad[2], quad[3]})
+				}
+			}
+		}
+	}
+
+	ibuf := &IndexBuffer{}
+	ibuf.ConvertFrom(&abuf)
+	return ibuf
+}
+
+// newGridPlane returns the unit square in the xy plane split into n by n
+// squares.
+func newGridPlane(n int) *IndexBuffer {
+	box := newGridBox(n)
+	abuf := ArrayBuffer{}
+	for _, face := range box.Faces {
+		tri := Triangle{box.Vertices[face[0]], box.Vertices[face[1]], box.Vertices[face[2]]}
+		if tri[0][2] == 1 && tri[1][2] == 1 && tri[2][2] == 1 {
+			abuf = append(abuf, tri)
+		}
+	}
+	ibuf := &IndexBuffer{}
+	ibuf.ConvertFrom(&abuf)
+	return ibuf
+}
+
+// checkManifold fails unless every edge of the mesh has at most one face on
+// each side, and if closed, exactly one.
+func checkManifold(t *testing.T, ibuf *IndexBuffer, closed bool) {
+	edges := make(map[[2]uint32]int)
+	for _, face := range ibuf.Faces {
+		if face[0] == face[1] || face[1] == face[2] || face[2] == face[0] {
+			t.Fatalf("Face %v is degenerate", face)
+		}
+		for i := range face {
+			edges[[2]uint32{face[i], face[(i+1)%3]}]++
+		}
+	}
+	for edge, count := range edges {
+		if count > 1 {
+			t.Fatalf("Edge %v has %d faces on one side", edge, count)
+		}
+		if closed && edges[[2]uint32{edge[1], edge[0]}] != 1 {
+			t.Fatalf("Mesh is open along %v", edge)
+		}
+	}
+}
+
+func TestSimplifySphere(t *testing.T) {
+	sphere, err := ConvexHullPoints(sphereDirections(2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume := Volume(sphere)
+
+	result := Simplify(sphere, &SimplifyOptions{TargetTriangles: 400})
+	if len(result.Faces) > 400 || len(result.Faces) < 390 {
+		t.Fatalf("Expected about 400 triangles, got %d", len(result.Faces))
+	}
+	checkManifold(t, result, true)
+	for _, vert := range result.Vertices {
+		if length := vert.Length(); math.Abs(length-1) > 0.02 {
+			t.Fatalf("Vertex %v is %v from the sphere", vert, length-1)
+		}
+	}
+	for _, face := range result.Faces {
+		tri := Triangle{result.Vertices[face[0]], result.Vertices[face[1]], result.Vertices[face[2]]}
+		normal, centroid := tri.Normal(), tri.Centroid()
+		if vec3.Dot(&normal, &centroid) <= 0 {
+			t.Fatalf("Face %v is turned over", tri)
+		}
+	}
+	if change := Volume(result)/volume - 1; math.Abs(change) > 0.02 {
+		t.Fatalf("Volume changed by %v", change)
+	}
+
+	// An error limit stops it early
+	limited := Simplify(sphere, &SimplifyOptions{MaxError: 0.01})
+	if len(limited.Faces) <= len(result.Faces) || len(limited.Faces) >= len(sphere.Faces) {
+		t.Fatalf("Expected a limited simplification, got %d triangles", len(limited.Faces))
+	}
+}
+
+func TestSimplifyFlat(t *testing.T) {
+	// Flat parts, open edges included, collapse without error
+	plane := newGridPlane(10)
+	result := Simplify(plane, &SimplifyOptions{MaxError: 1e-9})
+	checkManifold(t, result, false)
+	if len(result.Faces) > 20 {
+		t.Fatalf("Expected the plane to collapse, got %d triangles", len(result.Faces))
+	}
+	if area := Area(result); math.Abs(area-1) > 1e-9 {
+		t.Fatalf("Expected area 1, got %v", area)
+	}
+	for _, vert := range result.Vertices {
+		if vert[2] != 1 {
+			t.Fatalf("Vertex %v left the plane", vert)
+		}
+	}
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(result)
+	box := BoxTriangles(abuf...)
+	if box.LowerBound != (vec3.T{0, 0, 1}) || box.UpperBound != (vec3.T{1, 1, 1}) {
+		t.Fatalf("Expected the outline kept, got %v", box)
+	}
+
+	cube := newGridBox(4)
+	result = Simplify(cube, &SimplifyOptions{MaxError: 1e-9})
+	checkManifold(t, result, true)
+	if volume := Volume(result); math.Abs(volume-1) > 1e-9 {
+		t.Fatalf("Expected volume 1, got %v", volume)
+	}
+	if len(result.Faces) > 40 {
+		t.Fatalf("Expected the cube to collapse, got %d triangles", len(result.Faces))
+	}
+
+	// Locked, the vertices along the edges of the cube stay
+	result = Simplify(cube, &SimplifyOptions{TargetTriangles: 1, LockSharp: true})
+	checkManifold(t, result, true)
+	kept := 0
+	for _, vert := range result.Vertices {
+		onEdge := 0
+		for _, coord := range vert {
+			if coord == 0 || coord == 1 {
+				onEdge++
+			}
+		}
+		if onEdge >= 2 {
+			kept++
+		}
+	}
+	if kept != 8+12*3 {
+		t.Fatalf("Expected 44 vertices kept on edges, got %d", kept)
+	}
+}
@@ -0,0 +1,118 @@
+package slicer
+
+import "errors"
+
+var (
+	ErrLayerHeight    = errors.New("Layer height must be positive")
+	ErrExtrusionWidth = errors.New("Extrusion width must be positive")
+	ErrFilament       = errors.New("Filament diameter must be positive")
+	ErrInfillDensity  = errors.New("Infill density must be between 0 and 1")
+	ErrSpeed          = errors.New("Speeds must be positive")
+	ErrPerimeters     = errors.New("Perimeters must not be negative")
+	ErrMultiplier     = errors.New("Extrusion multiplier must be positive")
+)
+
+type InfillPattern int
+
+const (
+	// Parallel lines, turning 90° every layer
+	InfillRectilinear InfillPattern = iota
+	// Lines in both directions on every layer
+	InfillGrid
+)
+
+// Config holds the print settings. Lengths are in mm, speeds in mm/s and
+// temperatures in °C.
+type Config struct {
+	LayerHeight      float64
+	ExtrusionWidth   float64
+	FilamentDiameter float64
+
+	// Pick each layer's height from the slope of the surface, between
+	// MinLayerHeight and MaxLayerHeight, instead of using LayerHeight
+	AdaptiveLayers                 bool
+	MinLayerHeight, MaxLayerHeight float64
+	// Furthest the staircase on sloped surfaces may stick out
+	MaxCuspHeight float64
+
+	// Number of shells around each contour
+	Perimeters int
+	// Solid layers at the top and bottom of the part
+	TopLayers, BottomLayers int
+
+	InfillPattern InfillPattern
+	// Fraction of the interior filled, from 0 to 1
+	InfillDensity float64
+	// Direction of the infill lines in degrees
+	InfillAngle float64
+
+	PerimeterSpeed  float64
+	InfillSpeed     float64
+	TravelSpeed     float64
+	FirstLayerSpeed float64 // Used for everything on the first layer
+
+	NozzleTemperature float64
+	BedTemperature    float64
+
+	// Scales the amount of filament extruded
+	ExtrusionMultiplier float64
+
+	// Filament pulled back before travel moves
+	RetractLength float64
+	RetractSpeed  float64
+}
+
+// DefaultConfig returns settings for a typical 0.4 mm nozzle printing PLA.
+func DefaultConfig() *Config {
+	return &Config{
+		LayerHeight:      0.2,
+		ExtrusionWidth:   0.45,
+		FilamentDiameter: 1.75,
+
+		MinLayerHeight: 0.08,
+		MaxLayerHeight: 0.3,
+		MaxCuspHeight:  0.05,
+
+		Perimeters:   2,
+		TopLayers:    4,
+		BottomLayers: 3,
+
+		InfillPattern: InfillRectilinear,
+		InfillDensity: 0.2,
+		InfillAngle:   45,
+
+		PerimeterSpeed:  40,
+		InfillSpeed:     60,
+		TravelSpeed:     150,
+		FirstLayerSpeed: 20,
+
+		NozzleTemperature: 210,
+		BedTemperature:    60,
+
+		ExtrusionMultiplier: 1,
+
+		RetractLength: 1,
+		RetractSpeed:  35,
+	}
+}
+
+func (this *Config) validate() error {
+	switch {
+	case this.LayerHeight <= 0:
+		return ErrLayerHeight
+	case this.ExtrusionWidth <= 0:
+		return ErrExtrusionWidth
+	case this.FilamentDiameter <= 0:
+		return ErrFilament
+	case this.Perimeters < 0:
+		return ErrPerimeters
+	case this.InfillDensity < 0 || this.InfillDensity > 1:
+		return ErrInfillDensity
+	case this.PerimeterSpeed <= 0 || this.InfillSpeed <= 0 || this.TravelSpeed <= 0 ||
+		this.FirstLayerSpeed <= 0 || (this.RetractLength > 0 && this.RetractSpeed <= 0):
+		return ErrSpeed
+	case this.ExtrusionMultiplier <= 0:
+		return ErrMultiplier
+	}
+	return nil
+}
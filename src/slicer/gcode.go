@@ -0,0 +1,169 @@
+package slicer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	. "github.com/alexozer/go-mesh"
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+// Travel moves shorter than this, in mm, don't retract
+const retractMinTravel = 2
+
+// Export slices the mesh and writes G-code for it to path.
+func Export(mesh ArrayBuffer, path string, config *Config) error {
+	layers, err := Plan(mesh, config)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = WriteGCode(file, layers, config)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteGCode writes G-code printing the layers, using absolute coordinates
+// and absolute extrusion.
+func WriteGCode(w io.Writer, layers []*Layer, config *Config) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	filamentRadius := config.FilamentDiameter / 2
+	writer := &gcodeWriter{
+		Writer:          bufio.NewWriter(w),
+		config:          config,
+		filamentArea:    math.Pi * filamentRadius * filamentRadius,
+		positionUnknown: true,
+	}
+
+	writer.line("; Generated by go-mesh")
+	writer.line("G21 ; mm")
+	writer.line("G90 ; Absolute positions")
+	writer.line("M82 ; Absolute extrusion")
+	writer.line("M140 S%s", formatNumber(config.BedTemperature, 0))
+	writer.line("M104 S%s", formatNumber(config.NozzleTemperature, 0))
+	writer.line("G28 ; Home")
+	writer.line("M190 S%s", formatNumber(config.BedTemperature, 0))
+	writer.line("M109 S%s", formatNumber(config.NozzleTemperature, 0))
+	writer.line("G92 E0")
+
+	for i, layer := range layers {
+		writer.line(";LAYER:%d", i)
+		writer.line("G0 Z%s F%s", formatNumber(layer.Z, 3), formatNumber(config.TravelSpeed*60, 0))
+
+		for _, path := range layer.Paths {
+			speed := config.InfillSpeed
+			if path.Kind == PathPerimeter {
+				speed = config.PerimeterSpeed
+			}
+			if i == 0 {
+				speed = config.FirstLayerSpeed
+			}
+
+			writer.path(path, layer.Height, speed)
+		}
+	}
+
+	writer.retract()
+	writer.line("M104 S0")
+	writer.line("M140 S0")
+	writer.line("M84 ; Motors off")
+
+	return writer.Flush()
+}
+
+type gcodeWriter struct {
+	*bufio.Writer
+	config       *Config
+	filamentArea float64
+
+	position        vec2.T
+	positionUnknown bool
+	extruded        float64 // Absolute E
+	retracted       bool
+}
+
+// line writes one line of G-code. Errors are picked up by Flush.
+func (this *gcodeWriter) line(format string, args ...interface{}) {
+	fmt.Fprintf(this, format+"\n", args...)
+}
+
+func (this *gcodeWriter) path(path Path, height, speed float64) {
+	if len(path.Points) < 2 {
+		return
+	}
+
+	this.travel(path.Points[0])
+	points := path.Points[1:]
+	if path.Closed {
+		points = append(points, path.Points[0])
+	}
+
+	// Cross section of the bead, assuming a rectangle
+	perMM := this.config.ExtrusionWidth * height * this.config.ExtrusionMultiplier / this.filamentArea
+
+	this.line("G1 F%s", formatNumber(speed*60, 0))
+	for _, pt := range points {
+		this.extruded += vec2.Distance(&this.position, &pt) * perMM
+		this.position = pt
+		this.line("G1 X%s Y%s E%s", formatNumber(pt[0], 3), formatNumber(pt[1], 3), formatNumber(this.extruded, 5))
+	}
+}
+
+func (this *gcodeWriter) travel(pt vec2.T) {
+	if !this.positionUnknown && vec2.Distance(&this.position, &pt) < 1e-9 {
+		return
+	}
+
+	long := this.positionUnknown || vec2.Distance(&this.position, &pt) >= retractMinTravel
+	if long {
+		this.retract()
+	}
+	this.line("G0 X%s Y%s F%s", formatNumber(pt[0], 3), formatNumber(pt[1], 3), formatNumber(this.config.TravelSpeed*60, 0))
+	this.position = pt
+	this.positionUnknown = false
+	this.unretract()
+}
+
+func (this *gcodeWriter) retract() {
+	if this.retracted || this.config.RetractLength <= 0 {
+		return
+	}
+	this.retracted = true
+	this.line("G1 E%s F%s", formatNumber(this.extruded-this.config.RetractLength, 5),
+		formatNumber(this.config.RetractSpeed*60, 0))
+}
+
+func (this *gcodeWriter) unretract() {
+	if !this.retracted {
+		return
+	}
+	this.retracted = false
+	this.line("G1 E%s F%s", formatNumber(this.extruded, 5), formatNumber(this.config.RetractSpeed*60, 0))
+}
+
+// formatNumber writes val with at most the given decimal places.
+func formatNumber(val float64, places int) string {
+	scale := math.Pow(10, float64(places))
+	val = math.Round(val*scale) / scale
+	if val == 0 {
+		// No negative zero
+		val = 0
+	}
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
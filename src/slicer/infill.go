@@ -0,0 +1,83 @@
+package slicer
+
+import (
+	"math"
+	"sort"
+
+	"github.com/alexozer/go-mesh/polygon"
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+type segment [2]vec2.T
+
+// hatch fills the region, by the even-odd rule, with parallel lines spacing
+// apart running at angle degrees, dropping lines shorter than minLength. The
+// lines lie on a fixed grid, so hatching the same angle on different layers
+// stacks them up. Every other line runs backwards so the nozzle can zigzag
+// between them.
+func hatch(region polygon.Paths, spacing, angle, minLength float64) []segment {
+	radians := angle * math.Pi / 180
+	sin, cos := math.Sin(-radians), math.Cos(-radians)
+
+	// Rotate so the lines are horizontal
+	rotated := make([][]vec2.T, len(region))
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for i, loop := range region {
+		rotated[i] = make([]vec2.T, len(loop))
+		for j, pt := range loop {
+			rotated[i][j] = rotate(pt, sin, cos)
+			minY = math.Min(minY, rotated[i][j][1])
+			maxY = math.Max(maxY, rotated[i][j][1])
+		}
+	}
+
+	result := make([]segment, 0)
+	reverse := false
+	for line := math.Floor(minY / spacing); (line+0.5)*spacing < maxY; line++ {
+		y := (line + 0.5) * spacing
+
+		xs := make([]float64, 0)
+		for _, loop := range rotated {
+			for i := range loop {
+				p0, p1 := loop[i], loop[(i+1)%len(loop)]
+				if (p0[1] >= y) != (p1[1] >= y) {
+					xs = append(xs, p0[0]+(y-p0[1])*(p1[0]-p0[0])/(p1[1]-p0[1]))
+				}
+			}
+		}
+		sort.Float64s(xs)
+
+		segments := make([]segment, 0, len(xs)/2)
+		for i := 0; i+1 < len(xs); i += 2 {
+			if xs[i+1]-xs[i] < minLength {
+				continue
+			}
+			segments = append(segments, segment{
+				rotate(vec2.T{xs[i], y}, -sin, cos),
+				rotate(vec2.T{xs[i+1], y}, -sin, cos),
+			})
+		}
+
+		if reverse {
+			for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+				segments[i], segments[j] = segments[j], segments[i]
+			}
+			for i := range segments {
+				segments[i][0], segments[i][1] = segments[i][1], segments[i][0]
+			}
+		}
+		if len(segments) > 0 {
+			reverse = !reverse
+		}
+
+		result = append(result, segments...)
+	}
+
+	return result
+}
+
+// rotate turns pt about the origin by the angle with the given sine and
+// cosine.
+func rotate(pt vec2.T, sin, cos float64) vec2.T {
+	return vec2.T{pt[0]*cos - pt[1]*sin, pt[0]*sin + pt[1]*cos}
+}
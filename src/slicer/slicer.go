@@ -0,0 +1,136 @@
+// Package slicer turns meshes into toolpaths and G-code for FDM printers.
+package slicer
+
+import (
+	. "github.com/alexozer/go-mesh"
+	"github.com/alexozer/go-mesh/polygon"
+	"github.com/alexozer/go-mesh/svx"
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+type PathKind int
+
+const (
+	PathPerimeter PathKind = iota
+	PathInfill
+	PathSkin // Solid infill on the top and bottom of the part
+)
+
+// Path is one continuous extrusion.
+type Path struct {
+	Kind   PathKind
+	Points []vec2.T
+	Closed bool // Whether the path returns to its first point
+}
+
+// Layer holds the paths printed at one height.
+type Layer struct {
+	Z      float64 // Top of the layer above the bed
+	Height float64
+	Paths  []Path
+}
+
+// Plan slices the mesh and generates the toolpaths of every layer, with
+// layers LayerHeight thick or adaptive ones if the config asks for them. The
+// mesh keeps its x and y, and its lowest point is placed on the bed.
+func Plan(mesh ArrayBuffer, config *Config) ([]*Layer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	schedule := svx.UniformLayers(mesh, config.LayerHeight)
+	if config.AdaptiveLayers {
+		var err error
+		schedule, err = svx.AdaptiveLayers(mesh, config.MinLayerHeight, config.MaxLayerHeight, config.MaxCuspHeight)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return PlanSchedule(mesh, schedule, config)
+}
+
+// PlanSchedule is like Plan, but prints the layers of the given schedule.
+func PlanSchedule(mesh ArrayBuffer, schedule *svx.LayerSchedule, config *Config) ([]*Layer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	sections := svx.SliceSchedule(mesh, schedule)
+	outlines := make([]polygon.Paths, len(sections))
+	for i, section := range sections {
+		outlines[i] = section.Polygons()
+	}
+
+	tops := schedule.Tops()
+	layers := make([]*Layer, len(sections))
+	for i := range sections {
+		layers[i] = &Layer{
+			Z:      tops[i] - schedule.Bottom,
+			Height: schedule.Heights[i],
+			Paths:  planLayer(outlines, i, config),
+		}
+	}
+
+	return layers, nil
+}
+
+func planLayer(outlines []polygon.Paths, index int, config *Config) []Path {
+	width := config.ExtrusionWidth
+	paths := make([]Path, 0)
+
+	// Outermost shell first, so the visible surface isn't pushed around by
+	// the inner ones
+	for shell := 0; shell < config.Perimeters; shell++ {
+		loops := polygon.Offset(outlines[index], -(float64(shell)+0.5)*width, polygon.JoinMiter)
+		for _, loop := range loops {
+			paths = append(paths, Path{Kind: PathPerimeter, Points: loop, Closed: true})
+		}
+	}
+
+	interior := polygon.Offset(outlines[index], -float64(config.Perimeters)*width, polygon.JoinMiter)
+	if len(interior) == 0 {
+		return paths
+	}
+
+	// Anything not covered by the layers just above and below is skin
+	covered := interior
+	for other := index - config.BottomLayers; other <= index+config.TopLayers; other++ {
+		if other < 0 || other >= len(outlines) {
+			covered = nil
+			break
+		}
+		if other != index {
+			covered = polygon.Intersection(covered, outlines[other], polygon.NonZero)
+		}
+	}
+	exposed := polygon.Difference(interior, covered, polygon.NonZero)
+
+	skinAngle := config.InfillAngle
+	if index%2 == 1 {
+		skinAngle += 90
+	}
+	paths = appendSegments(paths, PathSkin, hatch(exposed, width, skinAngle, width))
+
+	if config.InfillDensity > 0 && len(covered) > 0 {
+		var sparse []segment
+		switch config.InfillPattern {
+		case InfillGrid:
+			spacing := 2 * width / config.InfillDensity
+			sparse = append(hatch(covered, spacing, config.InfillAngle, width),
+				hatch(covered, spacing, config.InfillAngle+90, width)...)
+		default:
+			sparse = hatch(covered, width/config.InfillDensity, skinAngle, width)
+		}
+		paths = appendSegments(paths, PathInfill, sparse)
+	}
+
+	return paths
+}
+
+func appendSegments(paths []Path, kind PathKind, segments []segment) []Path {
+	for _, seg := range segments {
+		paths = append(paths, Path{Kind: kind, Points: []vec2.T{seg[0], seg[1]}})
+	}
+	return paths
+}
@@ -0,0 +1,191 @@
+package slicer
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alexozer/go-mesh"
+	"github.com/alexozer/go-mesh/polygon"
+	"github.com/alexozer/go-mesh/svx"
+	"github.com/ungerik/go3d/float64/vec2"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func boxMesh(lower, upper vec3.T) mesh.ArrayBuffer {
+	var corners [8]vec3.T
+	for i := range corners {
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<uint(axis)) == 0 {
+				corners[i][axis] = lower[axis]
+			} else {
+				corners[i][axis] = upper[axis]
+			}
+		}
+	}
+
+	faces := [12][3]int{
+		{0, 2, 3}, {0, 3, 1}, // -z
+		{4, 5, 7}, {4, 7, 6}, // +z
+		{0, 1, 5}, {0, 5, 4}, // -y
+		{2, 6, 7}, {2, 7, 3}, // +y
+		{0, 4, 6}, {0, 6, 2}, // -x
+		{1, 3, 7}, {1, 7, 5}, // +x
+	}
+
+	abuf := make(mesh.ArrayBuffer, len(faces))
+	for i, face := range faces {
+		abuf[i] = mesh.Triangle{corners[face[0]], corners[face[1]], corners[face[2]]}
+	}
+	return abuf
+}
+
+func square(lower, upper float64) polygon.Path {
+	return polygon.Path{{lower, lower}, {upper, lower}, {upper, upper}, {lower, upper}}
+}
+
+func TestHatch(t *testing.T) {
+	region := polygon.Paths{square(0, 10), square(4, 6).Reversed()}
+	for _, angle := range []float64{0, 90} {
+		segments := hatch(region, 1, angle, 0)
+		var length float64
+		for _, seg := range segments {
+			length += vec2.Distance(&seg[0], &seg[1])
+		}
+		if math.Abs(length-(100-4)) > 1e-9 {
+			t.Fatalf("Angle %v: expected total length 96, got %v", angle, length)
+		}
+	}
+
+	// The lines beside the hole are 4 long, and the rest 10
+	if segments := hatch(region, 1, 0, 5); len(segments) != 8 {
+		t.Fatalf("Expected 8 long segments, got %d", len(segments))
+	}
+}
+
+func TestPlan(t *testing.T) {
+	config := DefaultConfig()
+	layers, err := Plan(boxMesh(vec3.T{0, 0, 0}, vec3.T{20, 20, 2}), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 10 || math.Abs(layers[9].Z-2) > 1e-9 {
+		t.Fatalf("Expected 10 layers up to 2 mm, got %d", len(layers))
+	}
+
+	for i, layer := range layers {
+		counts := make(map[PathKind]int)
+		for _, path := range layer.Paths {
+			counts[path.Kind]++
+		}
+
+		if counts[PathPerimeter] != 2 {
+			t.Fatalf("Layer %d: expected 2 perimeters, got %d", i, counts[PathPerimeter])
+		}
+		solid := i < config.BottomLayers || i >= len(layers)-config.TopLayers
+		if solid != (counts[PathSkin] > 0) || solid == (counts[PathInfill] > 0) {
+			t.Fatalf("Layer %d: %d skin and %d infill paths", i, counts[PathSkin], counts[PathInfill])
+		}
+	}
+
+	config.LayerHeight = 0
+	if _, err := Plan(boxMesh(vec3.T{0, 0, 0}, vec3.T{20, 20, 2}), config); err != ErrLayerHeight {
+		t.Fatalf("Expected ErrLayerHeight, got %v", err)
+	}
+
+	config = DefaultConfig()
+	config.Perimeters = -1
+	if _, err := Plan(boxMesh(vec3.T{0, 0, 0}, vec3.T{20, 20, 2}), config); err != ErrPerimeters {
+		t.Fatalf("Expected ErrPerimeters, got %v", err)
+	}
+
+	config = DefaultConfig()
+	config.ExtrusionMultiplier = 0
+	if _, err := Plan(boxMesh(vec3.T{0, 0, 0}, vec3.T{20, 20, 2}), config); err != ErrMultiplier {
+		t.Fatalf("Expected ErrMultiplier, got %v", err)
+	}
+}
+
+func TestWriteGCode(t *testing.T) {
+	config := DefaultConfig()
+	config.InfillDensity = 1
+
+	layers, err := Plan(boxMesh(vec3.T{0, 0, 0}, vec3.T{20, 20, 2}), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteGCode(&buf, layers, config); err != nil {
+		t.Fatal(err)
+	}
+
+	var numLayers int
+	var maxE float64
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ";LAYER:") {
+			numLayers++
+		}
+		for _, word := range strings.Fields(line) {
+			if strings.HasPrefix(word, "E") {
+				e, err := strconv.ParseFloat(word[1:], 64)
+				if err != nil {
+					t.Fatalf("Bad word %s in %q", word, line)
+				}
+				maxE = math.Max(maxE, e)
+			}
+		}
+	}
+
+	if numLayers != 10 {
+		t.Fatalf("Expected 10 layers, got %d", numLayers)
+	}
+
+	// A solid print should use about as much plastic as the box holds
+	radius := config.FilamentDiameter / 2
+	volume := maxE * math.Pi * radius * radius
+	if volume < 0.8*800 || volume > 1.1*800 {
+		t.Fatalf("Extruded %v mm³ for an 800 mm³ box", volume)
+	}
+}
+
+func TestPlanAdaptive(t *testing.T) {
+	config := DefaultConfig()
+	config.AdaptiveLayers = true
+
+	// A wedge whose top slopes up along x, 1 in 10
+	abuf := mesh.ArrayBuffer{
+		{{0, 0, 0}, {20, 20, 0}, {20, 0, 0}}, {{0, 0, 0}, {0, 20, 0}, {20, 20, 0}},
+		{{0, 0, 0}, {20, 0, 2}, {0, 20, 0}}, {{0, 20, 0}, {20, 0, 2}, {20, 20, 2}},
+		{{20, 0, 0}, {20, 20, 2}, {20, 0, 2}}, {{20, 0, 0}, {20, 20, 0}, {20, 20, 2}},
+		{{0, 0, 0}, {20, 0, 0}, {20, 0, 2}}, {{0, 20, 0}, {20, 20, 2}, {20, 20, 0}},
+	}
+	layers, err := Plan(abuf, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uniform := int(2 / config.LayerHeight)
+	if len(layers) <= uniform {
+		t.Fatalf("Expected thinner layers than %v, got %d layers", config.LayerHeight, len(layers))
+	}
+	z := 0.0
+	for i, layer := range layers {
+		z += layer.Height
+		if math.Abs(layer.Z-z) > 1e-9 || layer.Height > config.MaxLayerHeight+1e-9 {
+			t.Fatalf("Layer %d is %v thick with top at %v", i, layer.Height, layer.Z)
+		}
+	}
+	if math.Abs(z-2) > 1e-9 {
+		t.Fatalf("Layers end at %v", z)
+	}
+
+	config.MaxLayerHeight = 0
+	if _, err := Plan(abuf, config); err != svx.ErrLayerBounds {
+		t.Fatalf("Expected ErrLayerBounds, got %v", err)
+	}
+}
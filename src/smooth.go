@@ -0,0 +1,156 @@
+package mesh
+
+import (
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+type SmoothWeights int
+
+const (
+	// Every neighbor counts the same
+	SmoothUniform SmoothWeights = iota
+	// Neighbors count by the cotangents of the angles across their edges,
+	// so that the surface slides less within itself
+	SmoothCotangent
+)
+
+// SmoothOptions controls Laplacian smoothing.
+type SmoothOptions struct {
+	Weights SmoothWeights
+	// Part of the way each vertex moves towards the weighted average of its
+	// neighbors in a pass. Defaults to 0.5.
+	Lambda float64
+	// A negative step slightly larger than Lambda, taken after it in each
+	// pass, keeps the mesh from shrinking as in Taubin's λ|μ smoothing. Zero
+	// leaves it out; -0.53 suits the default Lambda.
+	Mu float64
+	// Defaults to 1.
+	Iterations int
+	// Keep the vertices of open edges in place, rather than smoothing them
+	// along the edges
+	PinBoundary bool
+}
+
+func (this *SmoothOptions) withDefaults() *SmoothOptions {
+	options := *this
+	if options.Lambda == 0 {
+		options.Lambda = 0.5
+	}
+	if options.Iterations <= 0 {
+		options.Iterations = 1
+	}
+	return &options
+}
+
+// Smooth returns a copy of the mesh with its vertices moved to take out
+// noise. The faces don't change.
+func Smooth(ibuf *IndexBuffer, options *SmoothOptions) *IndexBuffer {
+	options = options.withDefaults()
+	result := copyIndexBuffer(ibuf)
+	smoother := newSmoother(result, options)
+
+	steps := []float64{options.Lambda}
+	if options.Mu != 0 {
+		steps = append(steps, options.Mu)
+	}
+	for i := 0; i < options.Iterations; i++ {
+		for _, step := range steps {
+			smoother.step(step)
+		}
+	}
+	return result
+}
+
+// smoothEdge is an edge with the vertices across it.
+type smoothEdge struct {
+	ends     [2]uint32
+	opposite []uint32
+}
+
+type smoother struct {
+	ibuf     *IndexBuffer
+	options  *SmoothOptions
+	edges    []smoothEdge
+	boundary []bool
+}
+
+func newSmoother(ibuf *IndexBuffer, options *SmoothOptions) *smoother {
+	this := &smoother{
+		ibuf:     ibuf,
+		options:  options,
+		boundary: make([]bool, len(ibuf.Vertices)),
+	}
+
+	indices := make(map[[2]uint32]int)
+	for _, face := range ibuf.Faces {
+		for i := range face {
+			key := edgeKey(face[i], face[(i+1)%3])
+			index, exists := indices[key]
+			if !exists {
+				index = len(this.edges)
+				indices[key] = index
+				this.edges = append(this.edges, smoothEdge{ends: key})
+			}
+			this.edges[index].opposite = append(this.edges[index].opposite, face[(i+2)%3])
+		}
+	}
+	for _, edge := range this.edges {
+		if len(edge.opposite) == 1 {
+			this.boundary[edge.ends[0]], this.boundary[edge.ends[1]] = true, true
+		}
+	}
+	return this
+}
+
+// weight returns how much the ends of the edge pull on each other.
+func (this *smoother) weight(edge *smoothEdge) float64 {
+	if this.options.Weights != SmoothCotangent {
+		return 1
+	}
+
+	a, b := this.ibuf.Vertices[edge.ends[0]], this.ibuf.Vertices[edge.ends[1]]
+	var sum float64
+	for _, opposite := range edge.opposite {
+		c := this.ibuf.Vertices[opposite]
+		ca, cb := vec3.Sub(&a, &c), vec3.Sub(&b, &c)
+		cross := vec3.Cross(&ca, &cb)
+		if length := cross.Length(); length > 0 {
+			sum += vec3.Dot(&ca, &cb) / length
+		}
+	}
+
+	// Obtuse angles give negative weights, which can tangle the mesh
+	if sum < 0 {
+		return 0
+	}
+	return sum / 2
+}
+
+func (this *smoother) step(size float64) {
+	verts := this.ibuf.Vertices
+	sums := make([]vec3.T, len(verts))
+	totals := make([]float64, len(verts))
+	for i := range this.edges {
+		edge := &this.edges[i]
+		open := len(edge.opposite) == 1
+		weight := this.weight(edge)
+		for j, end := range edge.ends {
+			// Open edges only pull along themselves
+			if this.boundary[end] && !open {
+				continue
+			}
+			pull := vec3.Sub(&verts[edge.ends[1-j]], &verts[end])
+			pull.Scale(weight)
+			sums[end].Add(&pull)
+			totals[end] += weight
+		}
+	}
+
+	for i := range verts {
+		if totals[i] == 0 || this.boundary[i] && this.options.PinBoundary {
+			continue
+		}
+		sums[i].Scale(size / totals[i])
+		verts[i].Add(&sums[i])
+	}
+}
@@ -0,0 +1,125 @@
+package mesh
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// radii returns the mean distance of the vertices from the origin and their
+// spread about it.
+func radii(ibuf *IndexBuffer) (mean, spread float64) {
+	for _, vert := range ibuf.Vertices {
+		mean += vert.Length()
+	}
+	mean /= float64(len(ibuf.Vertices))
+	for _, vert := range ibuf.Vertices {
+		spread += (vert.Length() - mean) * (vert.Length() - mean)
+	}
+	return mean, math.Sqrt(spread / float64(len(ibuf.Vertices)))
+}
+
+func TestSmooth(t *testing.T) {
+	sphere, err := ConvexHullPoints(sphereDirections(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(3))
+	for i := range sphere.Vertices {
+		sphere.Vertices[i].Scale(1 + 0.03*(rng.Float64()-0.5))
+	}
+	_, noise := radii(sphere)
+
+	laplacian := Smooth(sphere, &SmoothOptions{Iterations: 10})
+	lapMean, lapSpread := radii(laplacian)
+	taubin := Smooth(sphere, &SmoothOptions{Mu: -0.53, Iterations: 10})
+	taubinMean, taubinSpread := radii(taubin)
+	cotangent := Smooth(sphere, &SmoothOptions{Weights: SmoothCotangent, Mu: -0.53, Iterations: 10})
+	_, cotSpread := radii(cotangent)
+
+	for _, spread := range []float64{lapSpread, taubinSpread, cotSpread} {
+		if spread > noise/2 {
+			t.Fatalf("Expected the noise of %v to go down, got %v", noise, spread)
+		}
+	}
+	if 1-lapMean < 0.01 {
+		t.Fatalf("Expected Laplacian smoothing to shrink the sphere, got radius %v", lapMean)
+	}
+	if math.Abs(1-taubinMean) > (1-lapMean)/5 {
+		t.Fatalf("Expected Taubin smoothing to keep the size, got radius %v", taubinMean)
+	}
+	if sphere.Vertices[0] == laplacian.Vertices[0] {
+		t.Fatal("Expected a copy to be smoothed, not the mesh")
+	}
+}
+
+// newTrianglePlane returns a flat sheet of n by n nearly equilateral
+// triangle pairs, jiggled within its plane.
+func newTrianglePlane(n int, rng *rand.Rand) *IndexBuffer {
+	ibuf := &IndexBuffer{}
+	for j := 0; j <= n; j++ {
+		for i := 0; i <= n; i++ {
+			vert := vec3.T{float64(i) + float64(j%2)/2, float64(j) * math.Sqrt(3) / 2, 0}
+			if i > 0 && i < n && j > 0 && j < n {
+				vert[0] += 0.1 * (rng.Float64() - 0.5)
+				vert[1] += 0.1 * (rng.Float64() - 0.5)
+			}
+			ibuf.Vertices = append(ibuf.Vertices, vert)
+		}
+	}
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			a, b := uint32(j*(n+1)+i), uint32(j*(n+1)+i+1)
+			c, d := a+uint32(n+1), b+uint32(n+1)
+			if j%2 == 0 {
+				ibuf.Faces = append(ibuf.Faces, Face{a, b, c}, Face{b, d, c})
+			} else {
+				ibuf.Faces = append(ibuf.Faces, Face{a, d, c}, Face{a, b, d})
+			}
+		}
+	}
+	return ibuf
+}
+
+func TestSmoothFlat(t *testing.T) {
+	// Cotangent weights leave flat parts be, uniform ones even them out
+	sheet := newTrianglePlane(8, rand.New(rand.NewSource(4)))
+	cotangent := Smooth(sheet, &SmoothOptions{Weights: SmoothCotangent, Iterations: 5, PinBoundary: true})
+	uniform := Smooth(sheet, &SmoothOptions{Iterations: 5, PinBoundary: true})
+	moved := false
+	for i, vert := range sheet.Vertices {
+		if dist := vec3.Distance(&vert, &cotangent.Vertices[i]); dist > 1e-9 {
+			t.Fatalf("Vertex %v slid by %v", vert, dist)
+		}
+		if !closeVec(vert, uniform.Vertices[i]) {
+			moved = true
+		}
+	}
+	if !moved {
+		t.Fatal("Expected uniform weights to move the vertices")
+	}
+
+	// Lift the inside, and smooth it with the edges pinned
+	plane := newGridPlane(8)
+	for i, vert := range plane.Vertices {
+		if vert[0] > 0 && vert[0] < 1 && vert[1] > 0 && vert[1] < 1 {
+			plane.Vertices[i][2] += 0.1
+		}
+	}
+	pinned := Smooth(plane, &SmoothOptions{PinBoundary: true, Iterations: 50})
+	free := Smooth(plane, &SmoothOptions{Iterations: 50})
+	for i, vert := range plane.Vertices {
+		onEdge := vert[0] == 0 || vert[0] == 1 || vert[1] == 0 || vert[1] == 1
+		if onEdge && pinned.Vertices[i] != vert {
+			t.Fatalf("Pinned vertex %v moved to %v", vert, pinned.Vertices[i])
+		}
+		if onEdge && math.Abs(free.Vertices[i][2]-1) > 1e-12 {
+			t.Fatalf("Open edge left its plane at %v", free.Vertices[i])
+		}
+		if !onEdge && pinned.Vertices[i][2]-1 > 0.05 {
+			t.Fatalf("Expected the inside to settle, got %v", pinned.Vertices[i])
+		}
+	}
+}
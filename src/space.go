@@ -2,6 +2,7 @@ package mesh
 
 import (
 	"math"
+	"sort"
 
 	"github.com/ungerik/go3d/float64/vec3"
 )
@@ -103,11 +104,31 @@ func (this *Box) IntersectsXY(z float64) bool {
 	return z > this.LowerBound[2] && z < this.UpperBound[2]
 }
 
+// DistanceSquared returns the squared distance from pt to the closest point
+// in the box, which is zero if pt is inside.
+func (this *Box) DistanceSquared(pt vec3.T) float64 {
+	var distSq float64
+	for i := 0; i < 3; i++ {
+		if pt[i] < this.LowerBound[i] {
+			d := this.LowerBound[i] - pt[i]
+			distSq += d * d
+		} else if pt[i] > this.UpperBound[i] {
+			d := pt[i] - this.UpperBound[i]
+			distSq += d * d
+		}
+	}
+	return distSq
+}
+
 type BoxedTriangle struct {
 	*Triangle
 	*Box
 }
 
+func NewBoxedTriangle(tri Triangle) *BoxedTriangle {
+	return &BoxedTriangle{&tri, BoxTriangle(tri)}
+}
+
 const octreeMaxTriangles = 10
 
 type Octree struct {
@@ -170,15 +191,60 @@ func (this *Octree) initChildren() {
 		bit #1: y-axis
 		bit #0: z-axis
 		*/
-		for i := uint(0); i < 3; i++ {
-			if i&(4>>i) == 0 {
-
-				child.LowerBound[i] = this.LowerBound[i]
-				child.UpperBound[i] = center[i]
+		for axis := uint(0); axis < 3; axis++ {
+			if i&(4>>axis) == 0 {
+				child.LowerBound[axis] = this.LowerBound[axis]
+				child.UpperBound[axis] = center[axis]
 			} else {
-				child.LowerBound[i] = center[i]
-				child.UpperBound[i] = this.UpperBound[i]
+				child.LowerBound[axis] = center[axis]
+				child.UpperBound[axis] = this.UpperBound[axis]
 			}
 		}
 	}
 }
+
+// Nearest returns the point on the triangles in the tree closest to pt. ok is
+// false if the tree is empty.
+func (this *Octree) Nearest(pt vec3.T) (closest vec3.T, ok bool) {
+	bestDistSq := math.Inf(1)
+	this.nearest(pt, &closest, &bestDistSq)
+	return closest, !math.IsInf(bestDistSq, 1)
+}
+
+func (this *Octree) nearest(pt vec3.T, closest *vec3.T, bestDistSq *float64) {
+	if this.DistanceSquared(pt) >= *bestDistSq {
+		return
+	}
+
+	for _, tri := range this.triangles {
+		if tri.Box.DistanceSquared(pt) >= *bestDistSq {
+			continue
+		}
+
+		candidate := tri.ClosestPoint(pt)
+		diff := vec3.Sub(&candidate, &pt)
+		if distSq := vec3.Dot(&diff, &diff); distSq < *bestDistSq {
+			*bestDistSq = distSq
+			*closest = candidate
+		}
+	}
+
+	if this.children[0] == nil {
+		return
+	}
+
+	// Visit the closest octants first so the rest are more likely pruned
+	var order [8]int
+	var distSqs [8]float64
+	for i, child := range this.children {
+		order[i] = i
+		distSqs[i] = child.DistanceSquared(pt)
+	}
+	sort.Slice(order[:], func(i, j int) bool {
+		return distSqs[order[i]] < distSqs[order[j]]
+	})
+
+	for _, i := range order {
+		this.children[i].nearest(pt, closest, bestDistSq)
+	}
+}
@@ -126,7 +126,7 @@ func (this *StlFile) read() <-chan Triangle {
 		var currTriangle int
 		for ; currTriangle < this.numTriangles; currTriangle++ {
 			binary.Read(file, binary.LittleEndian, &incomingTri)
-			triChan <- incomingTri.Tri
+			triChan <- incomingTri.triangle()
 		}
 
 		close(triChan)
@@ -135,10 +135,28 @@ func (this *StlFile) read() <-chan Triangle {
 	return triChan
 }
 
+// stlTriangle is a triangle as stored in the file: a 50 byte record of single
+// precision floats.
 type stlTriangle struct {
-	_   vec3.T // Normal
-	Tri Triangle
-	_   uint16 // Extra info
+	Normal [3]float32
+	Verts  [3][3]float32
+	_      uint16 // Extra info
+}
+
+func (this *stlTriangle) triangle() Triangle {
+	var tri Triangle
+	for i, vert := range this.Verts {
+		tri[i] = vec3.T{float64(vert[0]), float64(vert[1]), float64(vert[2])}
+	}
+	return tri
+}
+
+func (this *stlTriangle) setTriangle(tri Triangle) {
+	normal := tri.Normal()
+	this.Normal = [3]float32{float32(normal[0]), float32(normal[1]), float32(normal[2])}
+	for i, vert := range tri {
+		this.Verts[i] = [3]float32{float32(vert[0]), float32(vert[1]), float32(vert[2])}
+	}
 }
 
 func (this *StlFile) ConvertFrom(mesh Mesh) {
@@ -171,7 +189,7 @@ func (this *StlFile) ConvertFrom(mesh Mesh) {
 
 	var stlTri stlTriangle
 	for tri := range mesh.read() {
-		stlTri.Tri = tri
+		stlTri.setTriangle(tri)
 		binary.Write(file, binary.LittleEndian, stlTri)
 	}
 }
@@ -0,0 +1,146 @@
+package mesh
+
+import (
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// SubdivideMidpoint splits each triangle into four at the middles of its
+// edges, the given number of times. The shape stays the same.
+func SubdivideMidpoint(ibuf *IndexBuffer, iterations int) *IndexBuffer {
+	result := copyIndexBuffer(ibuf)
+	for i := 0; i < iterations; i++ {
+		result = subdivide(result, false)
+	}
+	return result
+}
+
+// SubdivideLoop splits each triangle into four and smooths the surface with
+// Loop's rules, the given number of times. Open edges smooth as cubic
+// B-splines of their own vertices, and corners with a single face stay in
+// place.
+func SubdivideLoop(ibuf *IndexBuffer, iterations int) *IndexBuffer {
+	result := copyIndexBuffer(ibuf)
+	for i := 0; i < iterations; i++ {
+		result = subdivide(result, true)
+	}
+	return result
+}
+
+func copyIndexBuffer(ibuf *IndexBuffer) *IndexBuffer {
+	return &IndexBuffer{
+		Vertices: append([]vec3.T{}, ibuf.Vertices...),
+		Faces:    append([]Face{}, ibuf.Faces...),
+	}
+}
+
+// subdivEdge is an edge being split, with the vertices across it.
+type subdivEdge struct {
+	middle   uint32
+	opposite []uint32
+}
+
+func edgeKey(a, b uint32) [2]uint32 {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]uint32{a, b}
+}
+
+func subdivide(ibuf *IndexBuffer, smooth bool) *IndexBuffer {
+	count := uint32(len(ibuf.Vertices))
+	edges := make(map[[2]uint32]*subdivEdge)
+	keys := make([][2]uint32, 0, len(ibuf.Faces)*3/2)
+	for _, face := range ibuf.Faces {
+		for i := range face {
+			key := edgeKey(face[i], face[(i+1)%3])
+			edge, exists := edges[key]
+			if !exists {
+				edge = &subdivEdge{middle: count + uint32(len(keys))}
+				edges[key] = edge
+				keys = append(keys, key)
+			}
+			edge.opposite = append(edge.opposite, face[(i+2)%3])
+		}
+	}
+
+	result := &IndexBuffer{
+		Vertices: make([]vec3.T, int(count)+len(keys)),
+		Faces:    make([]Face, 0, 4*len(ibuf.Faces)),
+	}
+	copy(result.Vertices, ibuf.Vertices)
+	for _, key := range keys {
+		edge := edges[key]
+		a, b := ibuf.Vertices[key[0]], ibuf.Vertices[key[1]]
+		middle := vec3.Interpolate(&a, &b, 0.5)
+		if smooth && len(edge.opposite) == 2 {
+			c, d := ibuf.Vertices[edge.opposite[0]], ibuf.Vertices[edge.opposite[1]]
+			for i := range middle {
+				middle[i] = 3.0/8*(a[i]+b[i]) + 1.0/8*(c[i]+d[i])
+			}
+		}
+		result.Vertices[edge.middle] = middle
+	}
+	if smooth {
+		smoothLoopVertices(ibuf, keys, edges, result.Vertices[:count])
+	}
+
+	for _, face := range ibuf.Faces {
+		ab := edges[edgeKey(face[0], face[1])].middle
+		bc := edges[edgeKey(face[1], face[2])].middle
+		ca := edges[edgeKey(face[2], face[0])].middle
+		result.Faces = append(result.Faces,
+			Face{face[0], ab, ca},
+			Face{ab, face[1], bc},
+			Face{ca, bc, face[2]},
+			Face{ab, bc, ca},
+		)
+	}
+	return result
+}
+
+// smoothLoopVertices moves the old vertices by Loop's vertex rules.
+func smoothLoopVertices(ibuf *IndexBuffer, keys [][2]uint32, edges map[[2]uint32]*subdivEdge, verts []vec3.T) {
+	neighbors := make([][]uint32, len(verts))
+	borders := make([][]uint32, len(verts))
+	faces := make([]int, len(verts))
+	for _, key := range keys {
+		edge := edges[key]
+		a, b := key[0], key[1]
+		neighbors[a] = append(neighbors[a], b)
+		neighbors[b] = append(neighbors[b], a)
+		if len(edge.opposite) == 1 {
+			borders[a] = append(borders[a], b)
+			borders[b] = append(borders[b], a)
+		}
+	}
+	for _, face := range ibuf.Faces {
+		for _, vert := range face {
+			faces[vert]++
+		}
+	}
+
+	for vert := range verts {
+		old := ibuf.Vertices[vert]
+		switch {
+		case len(borders[vert]) == 0 && len(neighbors[vert]) > 0:
+			n := float64(len(neighbors[vert]))
+			weight := 3.0/8 + math.Cos(2*math.Pi/n)/4
+			beta := (5.0/8 - weight*weight) / n
+			var sum vec3.T
+			for _, other := range neighbors[vert] {
+				sum.Add(&ibuf.Vertices[other])
+			}
+			for i := range old {
+				verts[vert][i] = (1-n*beta)*old[i] + beta*sum[i]
+			}
+		case len(borders[vert]) == 2 && faces[vert] > 1:
+			b0, b1 := ibuf.Vertices[borders[vert][0]], ibuf.Vertices[borders[vert][1]]
+			for i := range old {
+				verts[vert][i] = 3.0/4*old[i] + 1.0/8*(b0[i]+b1[i])
+			}
+		}
+		// Corners, and vertices where open edges meet oddly, stay put
+	}
+}
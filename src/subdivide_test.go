@@ -0,0 +1,92 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestSubdivideMidpoint(t *testing.T) {
+	abuf := newBoxMesh(vec3.T{0, 0, 0}, vec3.T{1, 2, 3})
+	box := &IndexBuffer{}
+	box.ConvertFrom(&abuf)
+
+	result := SubdivideMidpoint(box, 2)
+	checkManifold(t, result, true)
+	if len(result.Faces) != 12*16 {
+		t.Fatalf("Expected 192 triangles, got %d", len(result.Faces))
+	}
+	if volume := Volume(result); math.Abs(volume-6) > 1e-9 {
+		t.Fatalf("Expected volume 6, got %v", volume)
+	}
+	if area := Area(result); math.Abs(area-22) > 1e-9 {
+		t.Fatalf("Expected area 22, got %v", area)
+	}
+
+	// Vertices are V - E + F = 2 with E = 3F/2
+	if len(result.Vertices) != 2+len(result.Faces)/2 {
+		t.Fatalf("Expected shared vertices, got %d", len(result.Vertices))
+	}
+
+	if same := SubdivideMidpoint(box, 0); len(same.Faces) != 12 {
+		t.Fatalf("Expected no change, got %d triangles", len(same.Faces))
+	}
+}
+
+func TestSubdivideLoop(t *testing.T) {
+	octahedron := &IndexBuffer{
+		Vertices: []vec3.T{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}},
+		Faces: []Face{
+			{0, 2, 4}, {2, 1, 4}, {1, 3, 4}, {3, 0, 4},
+			{2, 0, 5}, {1, 2, 5}, {3, 1, 5}, {0, 3, 5},
+		},
+	}
+
+	result := SubdivideLoop(octahedron, 4)
+	checkManifold(t, result, true)
+	if len(result.Faces) != 8*256 {
+		t.Fatalf("Expected 2048 triangles, got %d", len(result.Faces))
+	}
+
+	// The octahedron rounds off towards a sphere, inside itself
+	low, high := math.Inf(1), 0.0
+	for _, vert := range result.Vertices {
+		length := vert.Length()
+		low, high = math.Min(low, length), math.Max(high, length)
+		if math.Abs(vert[0])+math.Abs(vert[1])+math.Abs(vert[2]) > 1+1e-9 {
+			t.Fatalf("Vertex %v is outside the octahedron", vert)
+		}
+	}
+	if high/low > 1.1 {
+		t.Fatalf("Expected a rounder shape, got radii from %v to %v", low, high)
+	}
+
+	// A lone triangle keeps its corners, and its edges stay straight
+	triangle := &IndexBuffer{
+		Vertices: []vec3.T{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}},
+		Faces:    []Face{{0, 1, 2}},
+	}
+	result = SubdivideLoop(triangle, 3)
+	checkManifold(t, result, false)
+	if len(result.Faces) != 64 {
+		t.Fatalf("Expected 64 triangles, got %d", len(result.Faces))
+	}
+	if area := Area(result); math.Abs(area-2) > 1e-9 {
+		t.Fatalf("Expected area 2, got %v", area)
+	}
+	for i, vert := range triangle.Vertices {
+		if result.Vertices[i] != vert {
+			t.Fatalf("Corner %v moved to %v", vert, result.Vertices[i])
+		}
+	}
+
+	// Open edges of a flat sheet smooth within its plane
+	result = SubdivideLoop(newGridPlane(3), 2)
+	checkManifold(t, result, false)
+	for _, vert := range result.Vertices {
+		if math.Abs(vert[2]-1) > 1e-12 {
+			t.Fatalf("Vertex %v left the plane", vert)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+type SupportStyle int
+
+const (
+	// A straight pillar under every support point
+	SupportGrid SupportStyle = iota
+	// Nearby support points share a trunk, reached by slanted branches
+	SupportTree
+)
+
+// SupportOptions controls overhang detection and support generation. Lengths
+// are in model units.
+type SupportOptions struct {
+	// Direction the part grows in while printing. Defaults to +z.
+	BuildDirection vec3.T
+	// Surfaces leaning further than this from vertical, in degrees, need
+	// support. Zero is reserved for the default of 45; a tiny angle such as
+	// 1e-9 supports every surface facing down.
+	OverhangAngle float64
+
+	Style SupportStyle
+	// Distance between support points. Defaults to 2.
+	Spacing float64
+	// Thickness of pillars and branches. Defaults to 0.8.
+	Width float64
+	// Space left between supports and the part above them
+	Gap float64
+}
+
+func (this *SupportOptions) withDefaults() *SupportOptions {
+	options := *this
+	if options.BuildDirection == (vec3.T{}) {
+		options.BuildDirection = vec3.UnitZ
+	}
+	if options.OverhangAngle == 0 {
+		options.OverhangAngle = 45
+	}
+	if options.Spacing <= 0 {
+		options.Spacing = 2
+	}
+	if options.Width <= 0 {
+		options.Width = 0.8
+	}
+	return &options
+}
+
+// Overhangs returns the indices of the triangles facing down steeply enough
+// to need support. Triangles lying on the build plate, at the lowest point of
+// the mesh, are left out.
+func Overhangs(mesh Mesh, options *SupportOptions) []int {
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	options = options.withDefaults()
+
+	frame := newBuildFrame(options.BuildDirection)
+	return overhangs(abuf.transform(frame.toFrame), options)
+}
+
+// GenerateSupports builds support structures under the overhangs of the mesh
+// as a separate mesh, to be merged with the part before slicing or export.
+// Supports stand on the build plate, or on the part where it is in the way.
+// Tree branches aren't checked against the part.
+func GenerateSupports(mesh Mesh, options *SupportOptions) ArrayBuffer {
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	if len(abuf) == 0 {
+		return ArrayBuffer{}
+	}
+	options = options.withDefaults()
+
+	frame := newBuildFrame(options.BuildDirection)
+	local := abuf.transform(frame.toFrame)
+	generator := &supportGenerator{
+		options:  options,
+		tris:     local,
+		index:    newColumnIndex(local, options.Spacing),
+		platform: BoxTriangles(local...).LowerBound[2],
+	}
+
+	var supports ArrayBuffer
+	contacts := generator.contacts(overhangs(local, options))
+	if options.Style == SupportTree {
+		supports = generator.trees(contacts)
+	} else {
+		supports = generator.pillars(contacts)
+	}
+
+	return supports.transform(frame.fromFrame)
+}
+
+// buildFrame is an orthonormal basis whose z axis is the build direction.
+type buildFrame struct {
+	axes [3]vec3.T
+}
+
+func newBuildFrame(direction vec3.T) *buildFrame {
+	up := direction.Normalized()
+	if up == vec3.UnitZ {
+		return &buildFrame{[3]vec3.T{vec3.UnitX, vec3.UnitY, vec3.UnitZ}}
+	}
+
+	// Any axis not parallel to up will do
+	helper := vec3.UnitX
+	if math.Abs(up[0]) > 0.9 {
+		helper = vec3.UnitY
+	}
+	u := vec3.Cross(&up, &helper)
+	u.Normalize()
+	v := vec3.Cross(&up, &u)
+	return &buildFrame{[3]vec3.T{u, v, up}}
+}
+
+func (this *buildFrame) toFrame(pt vec3.T) vec3.T {
+	return vec3.T{vec3.Dot(&pt, &this.axes[0]), vec3.Dot(&pt, &this.axes[1]), vec3.Dot(&pt, &this.axes[2])}
+}
+
+func (this *buildFrame) fromFrame(pt vec3.T) vec3.T {
+	var result vec3.T
+	for i, axis := range this.axes {
+		for j := range result {
+			result[j] += pt[i] * axis[j]
+		}
+	}
+	return result
+}
+
+// overhangs finds the overhangs of a mesh already in the build frame.
+func overhangs(local ArrayBuffer, options *SupportOptions) []int {
+	if len(local) == 0 {
+		return []int{}
+	}
+
+	platform := BoxTriangles(local...).LowerBound[2]
+	threshold := math.Sin(options.OverhangAngle * math.Pi / 180)
+
+	result := make([]int, 0)
+	for i, tri := range local {
+		if -tri.Normal()[2] <= threshold {
+			continue
+		}
+		if BoxTriangle(tri).UpperBound[2]-platform < epsilon {
+			continue
+		}
+		result = append(result, i)
+	}
+	return result
+}
+
+func (this ArrayBuffer) transform(f func(vec3.T) vec3.T) ArrayBuffer {
+	result := make(ArrayBuffer, len(this))
+	for i, tri := range this {
+		for j, vert := range tri {
+			result[i][j] = f(vert)
+		}
+	}
+	return result
+}
+
+// columnIndex buckets triangles by the cells of an xy grid they cover, to
+// find the triangles above or below a point.
+type columnIndex struct {
+	cellSize float64
+	cells    map[[2]int][]int
+}
+
+func newColumnIndex(tris ArrayBuffer, cellSize float64) *columnIndex {
+	index := &columnIndex{cellSize: cellSize, cells: make(map[[2]int][]int)}
+	for i, tri := range tris {
+		box := BoxTriangle(tri)
+		x0, y0 := index.cell(box.LowerBound[0], box.LowerBound[1])
+		x1, y1 := index.cell(box.UpperBound[0], box.UpperBound[1])
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				index.cells[[2]int{x, y}] = append(index.cells[[2]int{x, y}], i)
+			}
+		}
+	}
+	return index
+}
+
+func (this *columnIndex) cell(x, y float64) (int, int) {
+	return int(math.Floor(x / this.cellSize)), int(math.Floor(y / this.cellSize))
+}
+
+func (this *columnIndex) near(x, y float64) []int {
+	cx, cy := this.cell(x, y)
+	return this.cells[[2]int{cx, cy}]
+}
+
+type supportGenerator struct {
+	options  *SupportOptions
+	tris     ArrayBuffer // In the build frame
+	index    *columnIndex
+	platform float64
+}
+
+// contacts returns the points on the overhangs where supports attach, on a
+// grid of spacing lined up across the whole part, lowered by the gap. Points
+// with the part right below them are skipped.
+func (this *supportGenerator) contacts(overhangs []int) []vec3.T {
+	spacing := this.options.Spacing
+	result := make([]vec3.T, 0)
+	seen := make(map[[2]int][]float64)
+
+	for _, i := range overhangs {
+		tri := this.tris[i]
+		box := BoxTriangle(tri)
+		normalZ := doubledAreaZ(tri)
+
+		x0 := int(math.Ceil(box.LowerBound[0]/spacing - 0.5))
+		x1 := int(math.Floor(box.UpperBound[0]/spacing - 0.5))
+		y0 := int(math.Ceil(box.LowerBound[1]/spacing - 0.5))
+		y1 := int(math.Floor(box.UpperBound[1]/spacing - 0.5))
+		for gx := x0; gx <= x1; gx++ {
+			for gy := y0; gy <= y1; gy++ {
+				x, y := (float64(gx)+0.5)*spacing, (float64(gy)+0.5)*spacing
+				z, hit := rayHeight(tri, x, y, normalZ)
+				if !hit {
+					continue
+				}
+
+				// Points on edges hit both triangles
+				duplicate := false
+				for _, other := range seen[[2]int{gx, gy}] {
+					if math.Abs(other-z) < epsilon {
+						duplicate = true
+					}
+				}
+				if duplicate {
+					continue
+				}
+				seen[[2]int{gx, gy}] = append(seen[[2]int{gx, gy}], z)
+
+				// Nothing to hold up where the part rests on itself
+				if z-this.floor(vec3.T{x, y, z}) > this.options.Gap+epsilon {
+					result = append(result, vec3.T{x, y, z - this.options.Gap})
+				}
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i][0] != result[j][0] {
+			return result[i][0] < result[j][0]
+		}
+		return result[i][1] < result[j][1]
+	})
+	return result
+}
+
+// floor returns the height of the first upward facing surface at or straight
+// below pt, or the build plate if there is none.
+func (this *supportGenerator) floor(pt vec3.T) float64 {
+	result := this.platform
+	for _, i := range this.index.near(pt[0], pt[1]) {
+		tri := this.tris[i]
+		normalZ := doubledAreaZ(tri)
+		if normalZ <= 0 {
+			continue
+		}
+		if z, hit := rayHeight(tri, pt[0], pt[1], normalZ); hit && z < pt[2]+epsilon && z > result {
+			result = z
+		}
+	}
+	return result
+}
+
+func (this *supportGenerator) pillars(contacts []vec3.T) ArrayBuffer {
+	result := ArrayBuffer{}
+	for _, contact := range contacts {
+		bottom := contact
+		bottom[2] = this.floor(contact)
+		result = append(result, strut(bottom, contact, this.options.Width, 4)...)
+	}
+	return result
+}
+
+// Sides of the prisms that tree supports are made of
+const treeSides = 6
+
+// trees joins the contacts in each cell of a coarser grid to one trunk. The
+// trunk stops low enough that no branch leans more than 45°, and if the part
+// is in the way of that, the contacts get pillars instead.
+func (this *supportGenerator) trees(contacts []vec3.T) ArrayBuffer {
+	cellSize := 4 * this.options.Spacing
+	clusters := make(map[[2]int][]vec3.T)
+	keys := make([][2]int, 0)
+	for _, contact := range contacts {
+		key := [2]int{int(math.Floor(contact[0] / cellSize)), int(math.Floor(contact[1] / cellSize))}
+		if _, exists := clusters[key]; !exists {
+			keys = append(keys, key)
+		}
+		clusters[key] = append(clusters[key], contact)
+	}
+
+	result := ArrayBuffer{}
+	for _, key := range keys {
+		cluster := clusters[key]
+
+		var center vec3.T
+		for _, contact := range cluster {
+			center.Add(&contact)
+		}
+		center.Scale(1 / float64(len(cluster)))
+
+		top := math.Inf(1)
+		for _, contact := range cluster {
+			reach := math.Hypot(contact[0]-center[0], contact[1]-center[1])
+			top = math.Min(top, contact[2]-math.Max(reach, this.options.Width))
+		}
+		trunkTop := vec3.T{center[0], center[1], top}
+		trunkBottom := vec3.T{center[0], center[1], this.floor(trunkTop)}
+
+		if len(cluster) == 1 || trunkTop[2]-trunkBottom[2] < epsilon {
+			result = append(result, this.pillars(cluster)...)
+			continue
+		}
+
+		result = append(result, strut(trunkBottom, trunkTop, 2*this.options.Width, treeSides)...)
+		for _, contact := range cluster {
+			result = append(result, strut(trunkTop, contact, this.options.Width, treeSides)...)
+		}
+	}
+	return result
+}
+
+// strut returns a closed prism with the given number of sides running from a
+// to b. Square struts are width on a side, and have their sides along x and y
+// when they run along z. Other cross sections fit in a circle of diameter
+// width.
+func strut(a, b vec3.T, width float64, sides int) ArrayBuffer {
+	axis := vec3.Sub(&b, &a)
+	axis.Normalize()
+
+	// The part of x, or of y if that is too short, square to the axis
+	along := axis.Scaled(axis[0])
+	across := vec3.Sub(&vec3.UnitX, &along)
+	if across.Length() < 0.1 {
+		along = axis.Scaled(axis[1])
+		across = vec3.Sub(&vec3.UnitY, &along)
+	}
+	across.Normalize()
+	around := vec3.Cross(&axis, &across)
+
+	radius := width / 2
+	if sides == 4 {
+		radius = width / math.Sqrt2
+	}
+	ring := func(center vec3.T, i int) vec3.T {
+		angle := (float64(i%sides) + 0.5) * 2 * math.Pi / float64(sides)
+		c, s := math.Cos(angle)*radius, math.Sin(angle)*radius
+		return vec3.T{
+			center[0] + c*across[0] + s*around[0],
+			center[1] + c*across[1] + s*around[1],
+			center[2] + c*across[2] + s*around[2],
+		}
+	}
+
+	result := make(ArrayBuffer, 0, 4*sides-4)
+	for i := 0; i < sides; i++ {
+		a0, a1 := ring(a, i), ring(a, i+1)
+		b0, b1 := ring(b, i), ring(b, i+1)
+		result = append(result, Triangle{a0, a1, b1}, Triangle{a0, b1, b0})
+	}
+	for i := 1; i+1 < sides; i++ {
+		result = append(result,
+			Triangle{ring(a, 0), ring(a, i+1), ring(a, i)},
+			Triangle{ring(b, 0), ring(b, i), ring(b, i+1)},
+		)
+	}
+	return result
+}
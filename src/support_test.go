@@ -0,0 +1,129 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// newTableMesh returns a slab held up by a pillar in its middle.
+func newTableMesh() ArrayBuffer {
+	return append(newBoxMesh(vec3.T{0, 0, 5}, vec3.T{10, 10, 7}), newBoxMesh(vec3.T{4, 4, 0}, vec3.T{6, 6, 5})...)
+}
+
+// checkClosed fails unless every edge of the mesh is matched by one running
+// the other way.
+func checkClosed(t *testing.T, abuf ArrayBuffer) {
+	edges := make(map[[2]vec3.T]int)
+	for _, tri := range abuf {
+		for i := range tri {
+			edges[[2]vec3.T{tri[i], tri[(i+1)%3]}]++
+		}
+	}
+	for edge, count := range edges {
+		if edges[[2]vec3.T{edge[1], edge[0]}] != count {
+			t.Fatalf("Mesh is open along %v", edge)
+		}
+	}
+}
+
+func TestOverhangs(t *testing.T) {
+	table := newTableMesh()
+
+	overhangs := Overhangs(&table, &SupportOptions{})
+	if len(overhangs) != 2 {
+		t.Fatalf("Expected the underside of the slab, got %v", overhangs)
+	}
+	for _, i := range overhangs {
+		if table[i].Normal() != (vec3.T{0, 0, -1}) || table[i][0][2] != 5 {
+			t.Fatalf("Triangle %v is not an overhang", table[i])
+		}
+	}
+
+	// Printed upside down, the top of the pillar hangs under the slab
+	overhangs = Overhangs(&table, &SupportOptions{BuildDirection: vec3.T{0, 0, -1}})
+	if len(overhangs) != 2 {
+		t.Fatalf("Expected the top of the pillar, got %v", overhangs)
+	}
+	for _, i := range overhangs {
+		if table[i].Normal() != (vec3.T{0, 0, 1}) || table[i][0][2] != 5 {
+			t.Fatalf("Triangle %v is not an overhang", table[i])
+		}
+	}
+
+	// Walls only count as overhangs past 90°
+	if overhangs := Overhangs(&table, &SupportOptions{OverhangAngle: 89.9}); len(overhangs) != 2 {
+		t.Fatalf("Expected 2 overhangs, got %d", len(overhangs))
+	}
+}
+
+func TestGenerateSupports(t *testing.T) {
+	table := newTableMesh()
+	supports := GenerateSupports(&table, &SupportOptions{Width: 0.5})
+
+	// A pillar under every 2 mm of the slab, except where the pillar is
+	if len(supports) != 24*12 {
+		t.Fatalf("Expected 24 pillars, got %d triangles", len(supports))
+	}
+	checkClosed(t, supports)
+	if volume := Volume(&supports); math.Abs(volume-24*0.25*5) > 1e-6 {
+		t.Fatalf("Expected pillar volume %v, got %v", 24*0.25*5, volume)
+	}
+	box := BoxTriangles(supports...)
+	if box.LowerBound[2] != 0 || box.UpperBound[2] != 5 {
+		t.Fatalf("Pillars run from %v to %v", box.LowerBound[2], box.UpperBound[2])
+	}
+
+	trees := GenerateSupports(&table, &SupportOptions{Style: SupportTree, Width: 0.5, Gap: 0.1})
+	checkClosed(t, trees)
+	if Volume(&trees) <= 0 {
+		t.Fatal("Tree supports are inside out")
+	}
+	// Ends of slanted branches stick out by up to half their width
+	box = BoxTriangles(trees...)
+	if math.Abs(box.LowerBound[2]) > 1e-9 || box.UpperBound[2] < 4.9 || box.UpperBound[2] > 4.9+0.25 {
+		t.Fatalf("Trees run from %v to %v", box.LowerBound[2], box.UpperBound[2])
+	}
+
+	// Every support point is reached by a branch or a lone pillar
+	for x := 1.0; x < 10; x += 2 {
+		for y := 1.0; y < 10; y += 2 {
+			if x == 5 && y == 5 {
+				continue
+			}
+
+			contact := vec3.T{x, y, 4.9}
+			reached := false
+			for _, tri := range trees {
+				for _, vert := range tri {
+					if vec3.Distance(&vert, &contact) < 0.25*math.Sqrt2+1e-9 {
+						reached = true
+					}
+				}
+			}
+			if !reached {
+				t.Fatalf("No branch reaches %v, %v", x, y)
+			}
+		}
+	}
+}
+
+func TestStrut(t *testing.T) {
+	a, b := vec3.T{1, 2, 3}, vec3.T{4, 6, 3}
+	prism := strut(a, b, 2, 6)
+	checkClosed(t, prism)
+
+	// A regular hexagon of circumradius 1, 5 long
+	expected := 3 * math.Sqrt(3) / 2 * 5
+	if volume := Volume(&prism); math.Abs(volume-expected) > 1e-9 {
+		t.Fatalf("Expected volume %v, got %v", expected, volume)
+	}
+
+	// Square struts are as wide as asked, lined up with the axes
+	square := strut(vec3.T{0, 0, 0}, vec3.T{0, 0, 1}, 2, 4)
+	box := BoxTriangles(square...)
+	if !closeVec(box.LowerBound, vec3.T{-1, -1, 0}) || !closeVec(box.UpperBound, vec3.T{1, 1, 1}) {
+		t.Fatalf("Square strut spans %v to %v", box.LowerBound, box.UpperBound)
+	}
+}
@@ -0,0 +1,131 @@
+package svx
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	manifestName = "manifest.xml"
+	dirMode      = 0755
+	fileMode     = 0644
+)
+
+// buildArchive writes an .svx file at path. build writes the slice images
+// into buildDir and returns the manifest describing them. The files are
+// staged in buildDir, a temporary directory that is removed afterwards.
+func buildArchive(path string, build func(buildDir string) (*manifest, error)) error {
+	buildDir := path + ".d"
+	err := os.RemoveAll(buildDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.Mkdir(buildDir, dirMode)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(buildDir)
+
+	manifest, err := build(buildDir)
+	if err != nil {
+		return err
+	}
+
+	return writeArchive(path, buildDir, manifest)
+}
+
+// writeSlice writes one slice of a channel into the build directory.
+func writeSlice(buildDir string, channel *channel, index int, img image.Image) error {
+	sliceFilePath := filepath.Join(buildDir, filepath.FromSlash(fmt.Sprintf(channel.Slices, index)))
+	err := os.MkdirAll(filepath.Dir(sliceFilePath), dirMode)
+	if err != nil {
+		return err
+	}
+
+	sliceFile, err := os.Create(sliceFilePath)
+	if err != nil {
+		return err
+	}
+	defer sliceFile.Close()
+
+	if err = png.Encode(sliceFile, img); err != nil {
+		return err
+	}
+	return sliceFile.Close()
+}
+
+// writeArchive zips the manifest and every file under buildDir into the .svx
+// file at path, keeping paths relative to buildDir. The archive is written to
+// a temporary file beside path and renamed over it once complete, so failing
+// leaves whatever was at path untouched.
+func writeArchive(path, buildDir string, manifest *manifest) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	if err = file.Chmod(fileMode); err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(file)
+
+	manifestWriter, err := archive.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	if err = manifest.Write(manifestWriter); err != nil {
+		return err
+	}
+
+	err = filepath.Walk(buildDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relPath, err := filepath.Rel(buildDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		// PNGs are already compressed, so don't bother deflating them again
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:   filepath.ToSlash(relPath),
+			Method: zip.Store,
+		})
+		if err != nil {
+			return err
+		}
+
+		entryFile, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer entryFile.Close()
+
+		_, err = io.Copy(entry, entryFile)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,315 @@
+package svx
+
+import (
+	"math"
+	"sort"
+
+	. "github.com/alexozer/go-mesh"
+	"github.com/alexozer/go-mesh/polygon"
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+// Contour is a closed polygon in a slice plane. The last point connects back
+// to the first. Outer loops wind counter-clockwise and holes wind clockwise
+// when viewed from above.
+type Contour struct {
+	Points   []vec2.T
+	Hole     bool
+	Children []*Contour // Contours directly nested inside this one
+}
+
+// Section is the cross-section of a mesh with the plane z = Z.
+type Section struct {
+	Z        float64
+	Contours []*Contour // Outermost loops; everything else hangs off Children
+	Open     [][]vec2.T // Chains that could not be closed because the mesh leaks
+}
+
+// Slice cuts the mesh with the plane at height z and stitches the resulting
+// segments into closed contours.
+func Slice(mesh ArrayBuffer, z float64) *Section {
+	plane := zPlane(z)
+	lines := make([]planeLine, 0)
+	for i := range mesh {
+		line := plane.intersectTriangle(&mesh[i])
+		if line != nil {
+			lines = append(lines, *line)
+		}
+	}
+
+	return newSection(z, lines)
+}
+
+// SliceLayers cuts the mesh into layers of the given thickness, starting at
+// its lowest point, and returns the section through the middle of each.
+func SliceLayers(mesh ArrayBuffer, layerHeight float64) []*Section {
+	return SliceSchedule(mesh, UniformLayers(mesh, layerHeight))
+}
+
+// SliceSchedule returns the section through the middle of each layer of the
+// schedule.
+func SliceSchedule(mesh ArrayBuffer, schedule *LayerSchedule) []*Section {
+	return SliceAt(mesh, schedule.Middles())
+}
+
+// SliceAt returns the sections of the mesh at each of the increasing heights.
+// Triangles are swept upwards, so this is much faster than calling Slice for
+// every height.
+func SliceAt(mesh ArrayBuffer, heights []float64) []*Section {
+	sweep := newZSweep(boxTriangles(mesh))
+	sections := make([]*Section, len(heights))
+	for i, z := range heights {
+		plane := zPlane(z)
+		lines := make([]planeLine, 0)
+		for _, tri := range sweep.advance(z, z) {
+			line := plane.intersectTriangle(tri.Triangle)
+			if line != nil {
+				lines = append(lines, *line)
+			}
+		}
+
+		sections[i] = newSection(z, lines)
+	}
+
+	return sections
+}
+
+func newSection(z float64, lines []planeLine) *Section {
+	loops, open := stitchLines(lines)
+
+	section := &Section{Z: z, Open: open}
+	section.Contours = nestContours(loops)
+	return section
+}
+
+// Flatten returns every contour in the section, parents before children.
+func (this *Section) Flatten() []*Contour {
+	result := make([]*Contour, 0)
+
+	var walk func(contours []*Contour)
+	walk = func(contours []*Contour) {
+		for _, contour := range contours {
+			result = append(result, contour)
+			walk(contour.Children)
+		}
+	}
+	walk(this.Contours)
+
+	return result
+}
+
+// Polygons returns the closed contours of the section for use with package
+// polygon. Outer loops already wind counter-clockwise and holes clockwise.
+func (this *Section) Polygons() polygon.Paths {
+	contours := this.Flatten()
+	paths := make(polygon.Paths, len(contours))
+	for i, contour := range contours {
+		paths[i] = polygon.Path(contour.Points)
+	}
+	return paths
+}
+
+// stitchLines joins directed segments head to tail. Segments produced by
+// zPlane.intersectTriangle for a shared mesh edge meet at identical points,
+// so exact matching is enough for closed meshes; leftover chains whose ends
+// nearly touch are joined in a second pass.
+func stitchLines(lines []planeLine) (loops, open [][]vec2.T) {
+	byStart := make(map[vec2.T][]int)
+	byEnd := make(map[vec2.T][]int)
+	for i, line := range lines {
+		byStart[line[0]] = append(byStart[line[0]], i)
+		byEnd[line[1]] = append(byEnd[line[1]], i)
+	}
+
+	used := make([]bool, len(lines))
+	take := func(candidates []int) int {
+		for _, i := range candidates {
+			if !used[i] {
+				used[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+
+	loops = make([][]vec2.T, 0)
+	chains := make([][]vec2.T, 0)
+	for first := range lines {
+		if used[first] {
+			continue
+		}
+		used[first] = true
+		start, end := lines[first][0], lines[first][1]
+		chain := []vec2.T{start, end}
+
+		closed := false
+		for {
+			if end == start {
+				closed = true
+				break
+			}
+			next := take(byStart[end])
+			if next < 0 {
+				break
+			}
+			end = lines[next][1]
+			chain = append(chain, end)
+		}
+
+		if closed {
+			loops = append(loops, chain[:len(chain)-1])
+			continue
+		}
+
+		// Walk backwards from the start to pick up the rest of the chain.
+		var head []vec2.T
+		for {
+			prev := take(byEnd[start])
+			if prev < 0 {
+				break
+			}
+			start = lines[prev][0]
+			head = append(head, start)
+		}
+		reversePoints(head)
+		chains = append(chains, append(head, chain...))
+	}
+
+	loops, open = joinChains(loops, chains)
+	return dropDegenerate(loops), open
+}
+
+// snapDistance is how far apart, in mm, two chain ends may be and still be
+// joined.
+const snapDistance = 1e-6
+
+func joinChains(loops, chains [][]vec2.T) ([][]vec2.T, [][]vec2.T) {
+	near := func(a, b vec2.T) bool {
+		return math.Abs(a[0]-b[0]) <= snapDistance && math.Abs(a[1]-b[1]) <= snapDistance
+	}
+
+	open := make([][]vec2.T, 0)
+	for len(chains) > 0 {
+		chain := chains[0]
+		chains = chains[1:]
+
+		for {
+			end := chain[len(chain)-1]
+			if len(chain) > 2 && near(end, chain[0]) {
+				loops = append(loops, chain[:len(chain)-1])
+				chain = nil
+				break
+			}
+
+			joined := false
+			for i, other := range chains {
+				if near(end, other[0]) {
+					chain = append(chain, other[1:]...)
+					chains = append(chains[:i], chains[i+1:]...)
+					joined = true
+					break
+				}
+			}
+			if !joined {
+				break
+			}
+		}
+
+		if chain != nil {
+			open = append(open, chain)
+		}
+	}
+
+	return loops, open
+}
+
+func dropDegenerate(loops [][]vec2.T) [][]vec2.T {
+	result := make([][]vec2.T, 0, len(loops))
+	for _, loop := range loops {
+		if len(loop) >= 3 && signedArea(loop) != 0 {
+			result = append(result, loop)
+		}
+	}
+	return result
+}
+
+// nestContours builds the containment tree of the loops. A loop's depth in
+// the tree decides whether it is a hole, and its winding is normalized to
+// match.
+func nestContours(loops [][]vec2.T) []*Contour {
+	sort.Slice(loops, func(i, j int) bool {
+		return math.Abs(signedArea(loops[i])) > math.Abs(signedArea(loops[j]))
+	})
+
+	roots := make([]*Contour, 0)
+	placed := make([]*Contour, 0, len(loops))
+	for _, loop := range loops {
+		contour := &Contour{Points: loop}
+
+		// Loops are sorted by decreasing area, so the last placed loop that
+		// contains this one is the innermost.
+		var parent *Contour
+		for i := len(placed) - 1; i >= 0; i-- {
+			if polygonContains(placed[i].Points, loop[0]) {
+				parent = placed[i]
+				break
+			}
+		}
+
+		if parent == nil {
+			roots = append(roots, contour)
+		} else {
+			contour.Hole = !parent.Hole
+			parent.Children = append(parent.Children, contour)
+		}
+
+		if (signedArea(loop) < 0) != contour.Hole {
+			reversePoints(contour.Points)
+		}
+		placed = append(placed, contour)
+	}
+
+	return roots
+}
+
+// Area returns the signed area of the contour: positive for outer loops and
+// negative for holes.
+func (this *Contour) Area() float64 {
+	return signedArea(this.Points)
+}
+
+// Contains reports whether pt lies inside the contour, ignoring its children.
+func (this *Contour) Contains(pt vec2.T) bool {
+	return polygonContains(this.Points, pt)
+}
+
+// Shoelace formula
+func signedArea(points []vec2.T) float64 {
+	var area float64
+	for i := range points {
+		p0, p1 := points[i], points[(i+1)%len(points)]
+		area += p0[0]*p1[1] - p1[0]*p0[1]
+	}
+	return area / 2
+}
+
+// Even-odd crossing test
+func polygonContains(points []vec2.T, pt vec2.T) bool {
+	inside := false
+	for i := range points {
+		p0, p1 := points[i], points[(i+1)%len(points)]
+		if (p0[1] > pt[1]) != (p1[1] > pt[1]) {
+			x := p0[0] + (pt[1]-p0[1])*(p1[0]-p0[0])/(p1[1]-p0[1])
+			if pt[0] < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func reversePoints(points []vec2.T) {
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+}
@@ -0,0 +1,288 @@
+package svx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	. "github.com/alexozer/go-mesh"
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+// ExportDXF writes the section of the mesh at height z to a DXF file.
+func ExportDXF(mesh ArrayBuffer, path string, z float64) error {
+	return writeDXFFile(path, []*Section{Slice(mesh, z)})
+}
+
+// ExportDXFLayers slices the whole mesh into layers layerHeight mm thick, as
+// SliceLayers does, and writes them like ExportDXFSchedule.
+func ExportDXFLayers(mesh ArrayBuffer, path string, layerHeight float64) error {
+	if layerHeight <= 0 {
+		return ErrLayerHeight
+	}
+	return ExportDXFSchedule(mesh, path, UniformLayers(mesh, layerHeight))
+}
+
+// ExportDXFSchedule writes the section through the middle of each layer of
+// the schedule to one DXF file, each on its own layer.
+func ExportDXFSchedule(mesh ArrayBuffer, path string, schedule *LayerSchedule) error {
+	return writeDXFFile(path, SliceSchedule(mesh, schedule))
+}
+
+func writeDXFFile(path string, sections []*Section) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = WriteDXF(file, sections)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// dxfLayerName returns the name of the DXF layer holding a section.
+func dxfLayerName(index int) string {
+	return fmt.Sprintf("SLICE%d", index)
+}
+
+// WriteDXF writes sections as R2000 DXF in mm. Section i goes on layer SLICEi,
+// and every contour or open chain becomes an LWPOLYLINE at the height of its
+// section.
+func WriteDXF(w io.Writer, sections []*Section) error {
+	// The header gives the next free handle, so write everything after it
+	// first
+	var buffer bytes.Buffer
+	body := &dxfWriter{Writer: &buffer}
+	body.tables(len(sections))
+	body.blocks()
+	body.entities(sections)
+	body.objects()
+
+	buffered := bufio.NewWriter(w)
+	writer := &dxfWriter{Writer: buffered}
+	writer.group(0, "SECTION")
+	writer.group(2, "HEADER")
+	writer.group(9, "$ACADVER")
+	writer.group(1, "AC1015")
+	writer.group(9, "$HANDSEED")
+	writer.group(5, fmt.Sprintf("%X", body.handle+1))
+	writer.group(9, "$INSUNITS")
+	writer.group(70, "4") // mm
+	writer.group(9, "$MEASUREMENT")
+	writer.group(70, "1") // Metric
+	writer.group(0, "ENDSEC")
+	buffer.WriteTo(buffered)
+	writer.group(0, "EOF")
+
+	return buffered.Flush()
+}
+
+type dxfWriter struct {
+	io.Writer
+	handle int // Last handle given out
+
+	// Handles of the block records that own the entities of each space
+	modelSpace, paperSpace string
+}
+
+// group writes one code/value pair. Errors are picked up by Flush.
+func (this *dxfWriter) group(code int, value string) {
+	fmt.Fprintf(this, "%d\n%s\n", code, value)
+}
+
+func (this *dxfWriter) newHandle() string {
+	this.handle++
+	return fmt.Sprintf("%X", this.handle)
+}
+
+func (this *dxfWriter) tables(numSections int) {
+	this.group(0, "SECTION")
+	this.group(2, "TABLES")
+
+	this.table("VPORT", 0, nil)
+	this.table("LTYPE", 3, func(owner string) {
+		for _, name := range []string{"ByBlock", "ByLayer", "Continuous"} {
+			this.record("LTYPE", owner, "AcDbLinetypeTableRecord", name)
+			description := ""
+			if name == "Continuous" {
+				description = "Solid line"
+			}
+			this.group(3, description)
+			this.group(72, "65")
+			this.group(73, "0")
+			this.group(40, "0")
+		}
+	})
+	this.table("LAYER", numSections+1, func(owner string) {
+		for i := -1; i < numSections; i++ {
+			name := "0"
+			if i >= 0 {
+				name = dxfLayerName(i)
+			}
+			this.record("LAYER", owner, "AcDbLayerTableRecord", name)
+			this.group(62, "7") // White, or black on a light background
+			this.group(6, "Continuous")
+		}
+	})
+	this.table("STYLE", 1, func(owner string) {
+		this.record("STYLE", owner, "AcDbTextStyleTableRecord", "Standard")
+		this.group(40, "0")
+		this.group(41, "1")
+		this.group(50, "0")
+		this.group(71, "0")
+		this.group(42, "2.5")
+		this.group(3, "txt")
+		this.group(4, "")
+	})
+	this.table("VIEW", 0, nil)
+	this.table("UCS", 0, nil)
+	this.table("APPID", 1, func(owner string) {
+		this.record("APPID", owner, "AcDbRegAppTableRecord", "ACAD")
+	})
+	this.table("DIMSTYLE", 1, func(owner string) {
+		this.record("DIMSTYLE", owner, "AcDbDimStyleTableRecord", "Standard")
+	})
+	this.table("BLOCK_RECORD", 2, func(owner string) {
+		this.modelSpace = this.record("BLOCK_RECORD", owner, "AcDbBlockTableRecord", "*Model_Space")
+		this.paperSpace = this.record("BLOCK_RECORD", owner, "AcDbBlockTableRecord", "*Paper_Space")
+	})
+
+	this.group(0, "ENDSEC")
+}
+
+// table writes a symbol table, calling entries to write its records.
+func (this *dxfWriter) table(name string, count int, entries func(owner string)) {
+	handle := this.newHandle()
+	this.group(0, "TABLE")
+	this.group(2, name)
+	this.group(5, handle)
+	this.group(330, "0")
+	this.group(100, "AcDbSymbolTable")
+	this.group(70, fmt.Sprint(count))
+	if name == "DIMSTYLE" {
+		this.group(100, "AcDbDimStyleTable")
+	}
+	if entries != nil {
+		entries(handle)
+	}
+	this.group(0, "ENDTAB")
+}
+
+// record starts a symbol table record and returns its handle.
+func (this *dxfWriter) record(kind, owner, subclass, name string) string {
+	handle := this.newHandle()
+	this.group(0, kind)
+	if kind == "DIMSTYLE" {
+		this.group(105, handle)
+	} else {
+		this.group(5, handle)
+	}
+	this.group(330, owner)
+	this.group(100, "AcDbSymbolTableRecord")
+	this.group(100, subclass)
+	this.group(2, name)
+	this.group(70, "0")
+	return handle
+}
+
+func (this *dxfWriter) blocks() {
+	this.group(0, "SECTION")
+	this.group(2, "BLOCKS")
+	for _, space := range []struct {
+		name, owner string
+		paper       bool
+	}{{"*Model_Space", this.modelSpace, false}, {"*Paper_Space", this.paperSpace, true}} {
+		this.entity("BLOCK", space.owner, space.paper)
+		this.group(100, "AcDbBlockBegin")
+		this.group(2, space.name)
+		this.group(70, "0")
+		this.group(10, "0")
+		this.group(20, "0")
+		this.group(30, "0")
+		this.group(3, space.name)
+		this.group(1, "")
+
+		this.entity("ENDBLK", space.owner, space.paper)
+		this.group(100, "AcDbBlockEnd")
+	}
+	this.group(0, "ENDSEC")
+}
+
+// entity starts an entity on layer 0 and returns its handle.
+func (this *dxfWriter) entity(kind, owner string, paper bool) string {
+	handle := this.newHandle()
+	this.group(0, kind)
+	this.group(5, handle)
+	this.group(330, owner)
+	this.group(100, "AcDbEntity")
+	if paper {
+		this.group(67, "1")
+	}
+	this.group(8, "0")
+	return handle
+}
+
+func (this *dxfWriter) entities(sections []*Section) {
+	this.group(0, "SECTION")
+	this.group(2, "ENTITIES")
+	for i, section := range sections {
+		layer := dxfLayerName(i)
+		for _, contour := range section.Flatten() {
+			this.polyline(layer, section.Z, contour.Points, true)
+		}
+		for _, chain := range section.Open {
+			this.polyline(layer, section.Z, chain, false)
+		}
+	}
+	this.group(0, "ENDSEC")
+}
+
+func (this *dxfWriter) polyline(layer string, z float64, points []vec2.T, closed bool) {
+	flags := "0"
+	if closed {
+		flags = "1"
+	}
+
+	this.group(0, "LWPOLYLINE")
+	this.group(5, this.newHandle())
+	this.group(330, this.modelSpace)
+	this.group(100, "AcDbEntity")
+	this.group(8, layer)
+	this.group(100, "AcDbPolyline")
+	this.group(90, fmt.Sprint(len(points)))
+	this.group(70, flags)
+	this.group(38, formatMM(z))
+	for _, pt := range points {
+		this.group(10, formatMM(pt[0]))
+		this.group(20, formatMM(pt[1]))
+	}
+}
+
+// objects writes the root dictionary, which only holds the empty group
+// dictionary.
+func (this *dxfWriter) objects() {
+	root, groups := this.newHandle(), this.newHandle()
+
+	this.group(0, "SECTION")
+	this.group(2, "OBJECTS")
+	this.group(0, "DICTIONARY")
+	this.group(5, root)
+	this.group(330, "0")
+	this.group(100, "AcDbDictionary")
+	this.group(281, "1")
+	this.group(3, "ACAD_GROUP")
+	this.group(350, groups)
+
+	this.group(0, "DICTIONARY")
+	this.group(5, groups)
+	this.group(330, root)
+	this.group(100, "AcDbDictionary")
+	this.group(281, "1")
+	this.group(0, "ENDSEC")
+}
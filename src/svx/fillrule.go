@@ -0,0 +1,218 @@
+package svx
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	. "github.com/alexozer/go-mesh"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+var ErrFillRule = errors.New("Unknown fill rule")
+
+// FillRule decides which points count as inside a mesh.
+type FillRule int
+
+const (
+	// Inside where more surfaces face away from the point than towards it
+	// along a scanline. Overlapping shells merge, but reversed shells vanish.
+	FillPositive FillRule = iota
+	// Inside where a scanline has crossed an odd number of surfaces.
+	FillEvenOdd
+	// Inside where the scanline crossings don't cancel out, whichever way
+	// the surfaces face.
+	FillNonZero
+	// Inside where the generalized winding number of the original triangles
+	// is at least 1/2 in magnitude. Copes with holes in the mesh too, but
+	// evaluates a winding number for every voxel, so it is slower.
+	FillWinding
+)
+
+func (this FillRule) valid() bool {
+	return this >= FillPositive && this <= FillWinding
+}
+
+// inside reports whether a scanline with the given crossing count, adding 1
+// for every surface facing away, is inside the mesh. count is the number of
+// surfaces crossed regardless of direction.
+func (this FillRule) inside(depth, count int) bool {
+	switch this {
+	case FillEvenOdd:
+		return count%2 != 0
+	case FillNonZero:
+		return depth != 0
+	}
+	return depth > 0
+}
+
+// Magnitude of the winding number above which a point is inside
+const windingThreshold = 0.5
+
+// fillWinding adds the voxels whose centers the triangles wind around at
+// height z to the coverage, scaled by weight.
+func (this *layer) fillWinding(tree *windingTree, z float64, weight float64) {
+	width := this.Img.Rect.Dx()
+	for y := 0; y < this.Img.Rect.Dy(); y++ {
+		for x := 0; x < width; x++ {
+			center := vec3.T{
+				this.Origin[0] + (float64(x)+0.5)*this.VoxelSize,
+				this.Origin[1] + (float64(y)+0.5)*this.VoxelSize,
+				z,
+			}
+			if math.Abs(tree.windingNumber(&center)) >= windingThreshold {
+				this.coverage[y*width+x] += weight
+			}
+		}
+	}
+}
+
+// Leaves of a windingTree hold at most this many triangles
+const windingLeafSize = 8
+
+// A node stands in for its triangles once the point is this many times the
+// node's radius from its center
+const windingFarField = 2
+
+// windingTree is a bounding volume hierarchy over triangles for Barill et
+// al.'s fast winding numbers. Every node caches the first two terms of the
+// expansion of its triangles' solid angle about its center, which stand in
+// for them from far away, so only the triangles near a point are summed
+// exactly.
+type windingTree struct {
+	tris  []Triangle
+	nodes []windingNode
+}
+
+type windingNode struct {
+	center vec3.T // Area weighted centroid of the triangles
+	normal vec3.T // Sum of the triangles' normals, scaled by area
+	// Sum over the triangles of area * (centroid - center) * normal^T
+	moment [3][3]float64
+	radius float64 // Of the sphere around center holding the triangles
+
+	first, count int    // Triangles of the node in tris
+	children     [2]int // Zero for leaves, since the root is never a child
+}
+
+func newWindingTree(boxedTris []BoxedTriangle) *windingTree {
+	tree := &windingTree{tris: make([]Triangle, len(boxedTris))}
+	for i := range boxedTris {
+		tree.tris[i] = *boxedTris[i].Triangle
+	}
+	if len(tree.tris) > 0 {
+		tree.build(0, len(tree.tris))
+	}
+	return tree
+}
+
+// build adds the node holding tris[first:first+count] and its descendants,
+// returning the node's index.
+func (this *windingTree) build(first, count int) int {
+	tris := this.tris[first : first+count]
+
+	var node windingNode
+	node.first, node.count = first, count
+	var area float64
+	for i := range tris {
+		triArea := tris[i].Area()
+		centroid := tris[i].Centroid()
+		normal := tris[i].Plane().Normal
+		node.center.Add(centroid.Scale(triArea))
+		node.normal.Add(normal.Scale(0.5))
+		area += triArea
+	}
+	box := BoxTriangles(tris...)
+	if area > 0 {
+		node.center.Scale(1 / area)
+	} else {
+		node.center = box.Center()
+	}
+	for i := range tris {
+		for _, vert := range tris[i] {
+			node.radius = math.Max(node.radius, vec3.Distance(&vert, &node.center))
+		}
+
+		centroid := tris[i].Centroid()
+		offset := vec3.Sub(&centroid, &node.center)
+		normal := tris[i].Plane().Normal
+		for row := 0; row < 3; row++ {
+			for col := 0; col < 3; col++ {
+				node.moment[row][col] += 0.5 * offset[row] * normal[col]
+			}
+		}
+	}
+
+	index := len(this.nodes)
+	this.nodes = append(this.nodes, node)
+	if count <= windingLeafSize {
+		return index
+	}
+
+	// Split at the median along the longest side of the box
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if box.UpperBound[i]-box.LowerBound[i] > box.UpperBound[axis]-box.LowerBound[axis] {
+			axis = i
+		}
+	}
+	sort.Slice(tris, func(a, b int) bool {
+		return tris[a][0][axis]+tris[a][1][axis]+tris[a][2][axis] <
+			tris[b][0][axis]+tris[b][1][axis]+tris[b][2][axis]
+	})
+	half := count / 2
+	left := this.build(first, half)
+	right := this.build(first+half, count-half)
+	this.nodes[index].children = [2]int{left, right}
+	return index
+}
+
+// windingNumber returns the generalized winding number of the triangles
+// around pt: the total solid angle they subtend, over 4π. It is 1 inside a
+// closed mesh with outward faces, 0 outside, and varies smoothly across holes.
+func (this *windingTree) windingNumber(pt *vec3.T) float64 {
+	if len(this.nodes) == 0 {
+		return 0
+	}
+	return this.solidAngle(0, pt) / (4 * math.Pi)
+}
+
+func (this *windingTree) solidAngle(index int, pt *vec3.T) float64 {
+	node := &this.nodes[index]
+	offset := vec3.Sub(&node.center, pt)
+	dist := offset.Length()
+	if dist > windingFarField*node.radius {
+		// The solid angle is the flux of offset/dist³ through the triangles.
+		// Expand it to first order about the center.
+		dist3 := dist * dist * dist
+		result := vec3.Dot(&offset, &node.normal) / dist3
+		for row := 0; row < 3; row++ {
+			result += node.moment[row][row] / dist3
+			for col := 0; col < 3; col++ {
+				result -= 3 * offset[row] * node.moment[row][col] * offset[col] / (dist3 * dist * dist)
+			}
+		}
+		return result
+	}
+
+	if node.children[0] == 0 {
+		var total float64
+		for i := node.first; i < node.first+node.count; i++ {
+			total += solidAngle(&this.tris[i], pt)
+		}
+		return total
+	}
+	return this.solidAngle(node.children[0], pt) + this.solidAngle(node.children[1], pt)
+}
+
+// solidAngle returns the signed solid angle tri subtends at pt, by Van
+// Oosterom and Strackee's formula.
+func solidAngle(tri *Triangle, pt *vec3.T) float64 {
+	a, b, c := vec3.Sub(&tri[0], pt), vec3.Sub(&tri[1], pt), vec3.Sub(&tri[2], pt)
+	la, lb, lc := a.Length(), b.Length(), c.Length()
+
+	cross := vec3.Cross(&b, &c)
+	numerator := vec3.Dot(&a, &cross)
+	denominator := la*lb*lc + vec3.Dot(&a, &b)*lc + vec3.Dot(&a, &c)*lb + vec3.Dot(&b, &c)*la
+	return 2 * math.Atan2(numerator, denominator)
+}
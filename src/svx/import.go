@@ -0,0 +1,160 @@
+package svx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+var (
+	ErrNoManifest    = errors.New("SVX file has no manifest.xml")
+	ErrNoDensity     = errors.New("SVX file has no DENSITY channel")
+	ErrOrientation   = errors.New("Unsupported slice orientation")
+	ErrSliceSize     = errors.New("Slice size does not match the grid size")
+	ErrMissingSlices = errors.New("SVX file is missing slices")
+	ErrGridSize      = errors.New("Grid size does not fit the slices")
+)
+
+const (
+	// Bounds the width and height of imported slices in voxels, so a
+	// manifest can't make the grid size overflow
+	maxSliceSize = 1 << 16
+	// Bounds the voxels of an imported grid, a byte each
+	maxGridVoxels = 1 << 30
+)
+
+// Import reads the density channel of an .svx file into a voxel grid. Slices
+// may be stacked along any axis.
+func Import(path string) (*VoxelGrid, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	manifestFile, exists := files[manifestName]
+	if !exists {
+		return nil, ErrNoManifest
+	}
+	m, err := readManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	axes, err := Orientation(m.SlicesOrientation).axes()
+	if err != nil {
+		return nil, err
+	}
+	density := m.channel(defaultChannel.Type)
+	if density == nil {
+		return nil, ErrNoDensity
+	}
+
+	// Check the manifest against the archive before allocating anything: every
+	// slice is a file of its own, and the first one gives the slice size.
+	if !(m.VoxelSize > 0) || math.IsInf(float64(m.VoxelSize), 1) {
+		return nil, ErrVoxelSize
+	}
+	sizes := [3]int{m.GridSizeX, m.GridSizeY, m.GridSizeZ}
+	width, height, depth := sizes[axes[0]], sizes[axes[1]], sizes[axes[2]]
+	if width <= 0 || width > maxSliceSize || height <= 0 || height > maxSliceSize ||
+		depth <= 0 || depth > len(archive.File) || width*height*depth > maxGridVoxels {
+		return nil, ErrGridSize
+	}
+	firstSlice, exists := files[fmt.Sprintf(density.Slices, 0)]
+	if !exists {
+		return nil, ErrMissingSlices
+	}
+	if err = checkSlice(firstSlice, width, height); err != nil {
+		return nil, err
+	}
+
+	grid := NewVoxelGrid(m.GridSizeX, m.GridSizeY, m.GridSizeZ,
+		float64(m.VoxelSize)/mmSize, m.origin())
+
+	for slice := 0; slice < depth; slice++ {
+		sliceFile, exists := files[fmt.Sprintf(density.Slices, slice)]
+		if !exists {
+			return nil, ErrMissingSlices
+		}
+
+		img, err := readSlice(sliceFile, width, height)
+		if err != nil {
+			return nil, err
+		}
+
+		bounds := img.Bounds()
+
+		for row := 0; row < height; row++ {
+			for col := 0; col < width; col++ {
+				// Image rows run top to bottom, but the grid runs bottom to top
+				var p [3]int
+				p[axes[0]], p[axes[1]], p[axes[2]] = col, height-1-row, slice
+
+				gray := color.GrayModel.Convert(img.At(bounds.Min.X+col, bounds.Min.Y+row))
+				grid.Set(p[0], p[1], p[2], gray.(color.Gray).Y)
+			}
+		}
+	}
+
+	return grid, nil
+}
+
+func readManifest(file *zip.File) (*manifest, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	m := new(manifest)
+	if err = xml.NewDecoder(reader).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readSlice decodes a slice once its header shows it is width by height, so
+// a slice can't claim a size that takes more memory than the grid.
+func readSlice(file *zip.File, width, height int) (image.Image, error) {
+	if err := checkSlice(file, width, height); err != nil {
+		return nil, err
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return png.Decode(reader)
+}
+
+// checkSlice reads the header of a slice and checks that it is width by
+// height.
+func checkSlice(file *zip.File, width, height int) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	config, err := png.DecodeConfig(reader)
+	if err != nil {
+		return err
+	}
+	if config.Width != width || config.Height != height {
+		return ErrSliceSize
+	}
+	return nil
+}
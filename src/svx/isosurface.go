@@ -0,0 +1,233 @@
+package svx
+
+import (
+	"math"
+
+	. "github.com/alexozer/go-mesh"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// How strongly the QEF pulls a vertex towards the mean of its cell's edge
+// crossings. Keeps flat and degenerate cells stable without rounding off
+// corners.
+const qefRegularization = 0.05
+
+// ExtractSurface builds a closed mesh of the boundary between voxels denser
+// than isoLevel and the rest, using dual contouring: one vertex per cell
+// the surface passes through, placed by minimizing a quadratic error
+// function so that sharp features survive, and one quad per crossed grid
+// edge. Faces wind counter-clockwise seen from outside. Space outside the
+// grid counts as empty, so the surface is always closed.
+func ExtractSurface(grid *VoxelGrid, isoLevel float64) *IndexBuffer {
+	contourer := &dualContourer{
+		grid:     grid,
+		isoLevel: isoLevel,
+		cells:    make(map[[3]int]uint32),
+	}
+
+	ibuf := &IndexBuffer{Vertices: make([]vec3.T, 0), Faces: make([]Face, 0)}
+	contourer.ibuf = ibuf
+
+	// Cells span between voxel centers, so there is one more of them than
+	// voxels along each axis.
+	for z := -1; z < grid.SizeZ; z++ {
+		for y := -1; y < grid.SizeY; y++ {
+			for x := -1; x < grid.SizeX; x++ {
+				for axis := 0; axis < 3; axis++ {
+					contourer.contourEdge([3]int{x, y, z}, axis)
+				}
+			}
+		}
+	}
+
+	return ibuf
+}
+
+type dualContourer struct {
+	grid     *VoxelGrid
+	isoLevel float64
+	ibuf     *IndexBuffer
+	cells    map[[3]int]uint32 // Vertex index of each cell, keyed by its lower corner
+}
+
+func (this *dualContourer) density(p [3]int) float64 {
+	return float64(this.grid.At(p[0], p[1], p[2]))
+}
+
+func (this *dualContourer) inside(p [3]int) bool {
+	return this.density(p) >= this.isoLevel
+}
+
+// contourEdge emits a quad if the grid edge from voxel p along axis crosses
+// the surface. The quad joins the vertices of the four cells around the edge.
+func (this *dualContourer) contourEdge(p [3]int, axis int) {
+	q := p
+	q[axis]++
+	if this.inside(p) == this.inside(q) {
+		return
+	}
+
+	// b × c = axis, so these cells go counter-clockwise around the axis
+	b, c := (axis+1)%3, (axis+2)%3
+	var quad [4][3]int
+	for i, offset := range [4][2]int{{1, 1}, {0, 1}, {0, 0}, {1, 0}} {
+		quad[i] = p
+		quad[i][b] -= offset[0]
+		quad[i][c] -= offset[1]
+	}
+
+	var indices [4]uint32
+	for i, cell := range quad {
+		indices[i] = this.cellVertex(cell)
+	}
+
+	// The quad faces along +axis; flip it if outside is the other way
+	if !this.inside(p) {
+		indices[1], indices[3] = indices[3], indices[1]
+	}
+
+	this.ibuf.Faces = append(this.ibuf.Faces,
+		Face{indices[0], indices[1], indices[2]},
+		Face{indices[0], indices[2], indices[3]},
+	)
+}
+
+// cellVertex returns the index of the vertex of the cell whose lower corner is
+// voxel cell, creating it if necessary.
+func (this *dualContourer) cellVertex(cell [3]int) uint32 {
+	if index, exists := this.cells[cell]; exists {
+		return index
+	}
+
+	index := uint32(len(this.ibuf.Vertices))
+	this.cells[cell] = index
+
+	local := this.solveCell(cell)
+	center := this.grid.Center(cell[0], cell[1], cell[2])
+	local.Scale(this.grid.VoxelSize)
+	this.ibuf.Vertices = append(this.ibuf.Vertices, vec3.Add(&center, &local))
+
+	return index
+}
+
+// solveCell places a cell's vertex, in voxels relative to its lower corner.
+func (this *dualContourer) solveCell(cell [3]int) vec3.T {
+	var qef qefSolver
+	for axis := 0; axis < 3; axis++ {
+		b, c := (axis+1)%3, (axis+2)%3
+		for _, offset := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			p := cell
+			p[b] += offset[0]
+			p[c] += offset[1]
+			q := p
+			q[axis]++
+
+			d0, d1 := this.density(p), this.density(q)
+			if (d0 >= this.isoLevel) == (d1 >= this.isoLevel) {
+				continue
+			}
+
+			t := (this.isoLevel - d0) / (d1 - d0)
+			var point vec3.T
+			point[b], point[c] = float64(offset[0]), float64(offset[1])
+			point[axis] = t
+
+			g0, g1 := this.gradient(p), this.gradient(q)
+			normal := vec3.Interpolate(&g0, &g1, t)
+
+			// Density grows inwards, so the outward normal is the negated gradient
+			normal.Scale(-1)
+			qef.add(point, normal)
+		}
+	}
+
+	return qef.solve()
+}
+
+// gradient returns the central difference density gradient at a voxel.
+func (this *dualContourer) gradient(p [3]int) vec3.T {
+	var result vec3.T
+	for axis := 0; axis < 3; axis++ {
+		lower, upper := p, p
+		lower[axis]--
+		upper[axis]++
+		result[axis] = (this.density(upper) - this.density(lower)) / 2
+	}
+	return result
+}
+
+// qefSolver accumulates tangent planes and finds the point closest to all of
+// them, pulled slightly towards the mean of the plane points.
+type qefSolver struct {
+	ata       [3][3]float64
+	atb       vec3.T
+	massPoint vec3.T
+	numPoints int
+}
+
+func (this *qefSolver) add(point, normal vec3.T) {
+	this.massPoint.Add(&point)
+	this.numPoints++
+
+	if normal.Length() < epsilon {
+		return
+	}
+	normal.Normalize()
+
+	dist := vec3.Dot(&normal, &point)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			this.ata[i][j] += normal[i] * normal[j]
+		}
+		this.atb[i] += normal[i] * dist
+	}
+}
+
+// solve returns the minimizer, clamped to the unit cell.
+func (this *qefSolver) solve() vec3.T {
+	massPoint := this.massPoint.Scaled(1 / float64(this.numPoints))
+
+	// (AᵀA + λI)x = Aᵀb + λm
+	m := this.ata
+	rhs := this.atb
+	for i := 0; i < 3; i++ {
+		m[i][i] += qefRegularization
+		rhs[i] += qefRegularization * massPoint[i]
+	}
+
+	result, ok := solve3(m, rhs)
+	if !ok {
+		result = massPoint
+	}
+
+	for i := range result {
+		result[i] = math.Max(0, math.Min(1, result[i]))
+	}
+	return result
+}
+
+const epsilon = 1e-9
+
+// solve3 solves the 3×3 system m·x = rhs by Cramer's rule.
+func solve3(m [3][3]float64, rhs vec3.T) (vec3.T, bool) {
+	det := det3(m)
+	if math.Abs(det) < epsilon {
+		return vec3.T{}, false
+	}
+
+	var result vec3.T
+	for col := 0; col < 3; col++ {
+		replaced := m
+		for row := 0; row < 3; row++ {
+			replaced[row][col] = rhs[row]
+		}
+		result[col] = det3(replaced) / det
+	}
+	return result, true
+}
+
+func det3(m [3][3]float64) float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
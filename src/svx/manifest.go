@@ -3,8 +3,12 @@ package svx
 import (
 	"encoding/xml"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"time"
+
+	"github.com/ungerik/go3d/float64/vec3"
 )
 
 type manifest struct {
@@ -17,9 +21,9 @@ type manifest struct {
 	SubvoxelBits      int      `xml:"subvoxelBits,attr"`
 	SlicesOrientation string   `xml:"slicesOrientation,attr"`
 
-	Channel  channel         `xml:"channels>channel"`
-	Material material        `xml:"materials>material"`
-	Metadata []metadataEntry `xml:"metadata>entry"`
+	Channels  []channel       `xml:"channels>channel"`
+	Materials []material      `xml:"materials>material"`
+	Metadata  []metadataEntry `xml:"metadata>entry"`
 }
 
 var defaultManifest = manifest{
@@ -38,8 +42,8 @@ func newManifest(author string, gridSizeX, gridSizeY, gridSizeZ int, voxelSize f
 	m.GridSizeZ = gridSizeZ
 	m.VoxelSize = voxelSize
 
-	m.Channel = defaultChannel
-	m.Material = defaultMaterial
+	m.Channels = []channel{defaultChannel}
+	m.Materials = []material{defaultMaterial}
 	m.Metadata = newMetadata(author)
 
 	return &m
@@ -55,10 +59,36 @@ type channel struct {
 const sliceDir = "density"
 const sliceFormat = `slice%d.png`
 
-var defaultChannel = channel{
-	Type:   "DENSITY",
-	Bits:   8,
-	Slices: sliceDir + string(os.PathSeparator) + sliceFormat,
+// Paths inside the archive always use forward slashes
+var (
+	defaultChannel = channel{
+		Type:   "DENSITY",
+		Bits:   8,
+		Slices: sliceDir + "/" + sliceFormat,
+	}
+
+	// Holds the id of each voxel's material, or 0 for none
+	materialChannel = channel{
+		Type:   "MATERIAL",
+		Bits:   8,
+		Slices: "material/" + sliceFormat,
+	}
+
+	colorChannels = [3]channel{
+		{Type: "COLOR_R", Bits: 8, Slices: "color_r/" + sliceFormat},
+		{Type: "COLOR_G", Bits: 8, Slices: "color_g/" + sliceFormat},
+		{Type: "COLOR_B", Bits: 8, Slices: "color_b/" + sliceFormat},
+	}
+)
+
+// channel returns the channel of the given type, or nil if there isn't one.
+func (this *manifest) channel(channelType string) *channel {
+	for i := range this.Channels {
+		if this.Channels[i].Type == channelType {
+			return &this.Channels[i]
+		}
+	}
+	return nil
 }
 
 type material struct {
@@ -93,6 +123,36 @@ func newMetadata(author string) []metadataEntry {
 	}
 }
 
+// SVX has no notion of where the grid sits in space, so the origin is kept in
+// metadata, in m like voxelSize.
+var originKeys = [3]string{"originX", "originY", "originZ"}
+
+func (this *manifest) setOrigin(originMM vec3.T) {
+	for i, key := range originKeys {
+		this.Metadata = append(this.Metadata, metadataEntry{
+			Key:   key,
+			Value: strconv.FormatFloat(originMM[i]*mmSize, 'g', -1, 64),
+		})
+	}
+}
+
+// origin returns the origin stored by setOrigin in mm, or zero if the file
+// doesn't have one.
+func (this *manifest) origin() vec3.T {
+	var originMM vec3.T
+	for _, entry := range this.Metadata {
+		for i, key := range originKeys {
+			if entry.Key != key {
+				continue
+			}
+			if val, err := strconv.ParseFloat(entry.Value, 64); err == nil {
+				originMM[i] = val / mmSize
+			}
+		}
+	}
+	return originMM
+}
+
 func (this *manifest) Export(filepath string) error {
 	err := os.Remove(filepath)
 	if err != nil && !os.IsNotExist(err) {
@@ -103,20 +163,24 @@ func (this *manifest) Export(filepath string) error {
 	if err != nil {
 		return err
 	}
-	file.WriteString(manifestHeader)
-
-	encoder := xml.NewEncoder(file)
-	encoder.Indent("", "  ")
 
-	err = encoder.Encode(this)
+	err = this.Write(file)
 	if err != nil {
+		file.Close()
 		return err
 	}
 
-	err = file.Close()
+	return file.Close()
+}
+
+func (this *manifest) Write(w io.Writer) error {
+	_, err := io.WriteString(w, manifestHeader)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	return encoder.Encode(this)
 }
@@ -0,0 +1,157 @@
+package svx
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	. "github.com/alexozer/go-mesh"
+)
+
+var (
+	ErrMaterialId        = errors.New("Material ids must be between 1 and 255")
+	ErrDuplicateMaterial = errors.New("Material id is used with two different URNs")
+)
+
+// Material identifies what a part is printed in. Id is what gets written
+// into the MATERIAL channel.
+type Material struct {
+	Id  int
+	Urn string
+}
+
+var DefaultMaterial = Material{defaultMaterial.Id, defaultMaterial.Urn}
+
+// Part is one mesh of a multi-material export. If any part has a Color, the
+// export gets color channels, and parts without one are white.
+type Part struct {
+	Mesh     ArrayBuffer
+	Material Material
+	Color    color.Color
+}
+
+// ExportParts voxelizes several meshes into one .svx file. Each voxel takes
+// the material and color of the part covering most of it, with later parts
+// winning ties, and the density of that part.
+func ExportParts(parts []Part, path string, author string, voxelSize float32) error {
+	return ExportPartsWithOptions(parts, path, &ExportOptions{Author: author, VoxelSize: voxelSize})
+}
+
+// ExportPartsWithOptions is like ExportParts. options.Material is ignored,
+// since every part has its own.
+func ExportPartsWithOptions(parts []Part, path string, options *ExportOptions) error {
+	options, err := options.withDefaults()
+	if err != nil {
+		return err
+	}
+	return exportParts(parts, path, options, true)
+}
+
+// partMaterials returns the distinct materials of the parts.
+func partMaterials(parts []Part) ([]material, error) {
+	urns := make(map[int]string)
+	materials := make([]material, 0)
+	for _, part := range parts {
+		id, urn := part.Material.Id, part.Material.Urn
+		if id < 1 || id > 255 {
+			return nil, ErrMaterialId
+		}
+
+		if existing, exists := urns[id]; exists {
+			if existing != urn {
+				return nil, ErrDuplicateMaterial
+			}
+			continue
+		}
+
+		urns[id] = urn
+		materials = append(materials, material{Id: id, Urn: urn})
+	}
+
+	return materials, nil
+}
+
+// sliceWriter writes the channels of each slice from the layers of its parts.
+type sliceWriter struct {
+	parts         []Part
+	bits          int
+	withMaterials bool
+	withColor     bool
+}
+
+func (this *sliceWriter) write(buildDir string, index int, layers []*layer) error {
+	rect := layers[0].Img.Rect
+	density := image.NewGray(rect)
+	materialIds := image.NewGray(rect)
+	var colors [3]*image.Gray
+	if this.withColor {
+		for i := range colors {
+			colors[i] = image.NewGray(rect)
+		}
+	}
+
+	for i := range density.Pix {
+		owner := -1
+		var maxDensity uint8
+		for part, layer := range layers {
+			if layer.Img.Pix[i] > 0 && layer.Img.Pix[i] >= maxDensity {
+				owner = part
+				maxDensity = layer.Img.Pix[i]
+			}
+		}
+		if owner < 0 {
+			continue
+		}
+
+		density.Pix[i] = maxDensity
+		materialIds.Pix[i] = uint8(this.parts[owner].Material.Id)
+
+		if this.withColor {
+			partColor := color.Color(color.White)
+			if this.parts[owner].Color != nil {
+				partColor = this.parts[owner].Color
+			}
+
+			rgba := color.NRGBAModel.Convert(partColor).(color.NRGBA)
+			colors[0].Pix[i], colors[1].Pix[i], colors[2].Pix[i] = rgba.R, rgba.G, rgba.B
+		}
+	}
+
+	var densityImg image.Image = density
+	if this.bits == 1 {
+		densityImg = threshold(density)
+	}
+	err := writeSlice(buildDir, &defaultChannel, index, densityImg)
+	if err != nil || !this.withMaterials {
+		return err
+	}
+
+	err = writeSlice(buildDir, &materialChannel, index, materialIds)
+	if err != nil {
+		return err
+	}
+
+	if this.withColor {
+		for i, img := range colors {
+			if err = writeSlice(buildDir, &colorChannels[i], index, img); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var binaryPalette = color.Palette{color.Black, color.White}
+
+// threshold turns densities into a two color image, which PNG stores with one
+// bit per pixel.
+func threshold(img *image.Gray) *image.Paletted {
+	result := image.NewPaletted(img.Rect, binaryPalette)
+	for i, density := range img.Pix {
+		if density >= solidThreshold {
+			result.Pix[i] = 1
+		}
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+package svx
+
+import "math"
+
+// Voxels at least this dense count as solid for morphology operations
+const solidThreshold = 128
+
+// Dilate returns a grid grown by radius mm in every direction. The grid is
+// padded so nothing is clipped. Voxels in the result are either empty or
+// fully solid.
+func (this *VoxelGrid) Dilate(radius float64) *VoxelGrid {
+	r := radius / this.VoxelSize
+	pad := int(math.Ceil(r))
+	result := this.resized(
+		[3]int{-pad, -pad, -pad},
+		[3]int{this.SizeX + pad, this.SizeY + pad, this.SizeZ + pad},
+	)
+
+	// Distance from every voxel to the nearest solid one
+	dists := squaredDistances(result, true)
+	for i, dist := range dists {
+		result.Density[i] = binaryDensity(dist <= r*r)
+	}
+
+	return result
+}
+
+// Erode returns a grid shrunk by radius mm in every direction. Space outside
+// the grid counts as empty. Voxels in the result are either empty or fully
+// solid.
+func (this *VoxelGrid) Erode(radius float64) *VoxelGrid {
+	r := radius / this.VoxelSize
+
+	// Pad by a voxel so the grid boundary erodes like any other surface
+	padded := this.resized([3]int{-1, -1, -1}, [3]int{this.SizeX + 1, this.SizeY + 1, this.SizeZ + 1})
+
+	// Distance from every voxel to the nearest empty one
+	dists := squaredDistances(padded, false)
+	for i, dist := range dists {
+		padded.Density[i] = binaryDensity(dist > r*r)
+	}
+
+	return padded.resized([3]int{1, 1, 1}, [3]int{this.SizeX + 1, this.SizeY + 1, this.SizeZ + 1})
+}
+
+// Hollow returns the grid with its interior removed, leaving walls of the
+// given thickness in mm.
+func (this *VoxelGrid) Hollow(wallThickness float64) *VoxelGrid {
+	result, _ := this.Difference(this.Erode(wallThickness))
+	return result
+}
+
+func binaryDensity(solid bool) uint8 {
+	if solid {
+		return 255
+	}
+	return 0
+}
+
+// Stands in for infinity, which would turn the parabola intersections into NaN
+const farAway = 1e20
+
+// squaredDistances returns, for every voxel, the squared distance in voxels
+// to the nearest solid voxel if toSolid is set, or else to the nearest empty
+// voxel. It uses the separable exact Euclidean distance transform of
+// Felzenszwalb and Huttenlocher, one pass per axis.
+func squaredDistances(grid *VoxelGrid, toSolid bool) []float64 {
+	dists := make([]float64, len(grid.Density))
+	for i, density := range grid.Density {
+		if (density >= solidThreshold) == toSolid {
+			dists[i] = 0
+		} else {
+			dists[i] = farAway
+		}
+	}
+
+	sizes := [3]int{grid.SizeX, grid.SizeY, grid.SizeZ}
+	strides := [3]int{1, grid.SizeX, grid.SizeX * grid.SizeY}
+
+	maxSize := maxInt(sizes[0], maxInt(sizes[1], sizes[2]))
+	line := make([]float64, maxSize)
+	transformed := make([]float64, maxSize)
+	scratch := newTransformScratch(maxSize)
+
+	for axis := 0; axis < 3; axis++ {
+		n, stride := sizes[axis], strides[axis]
+		for start := range dists {
+			// Visit each line along the axis once, starting from its first voxel
+			if (start/stride)%n != 0 {
+				continue
+			}
+
+			for i := 0; i < n; i++ {
+				line[i] = dists[start+i*stride]
+			}
+			scratch.transform(line[:n], transformed[:n])
+			for i := 0; i < n; i++ {
+				dists[start+i*stride] = transformed[i]
+			}
+		}
+	}
+
+	return dists
+}
+
+type transformScratch struct {
+	vertices   []int     // Locations of the parabolas in the lower envelope
+	boundaries []float64 // Where each parabola starts being the lowest
+}
+
+func newTransformScratch(size int) *transformScratch {
+	return &transformScratch{
+		vertices:   make([]int, size),
+		boundaries: make([]float64, size+1),
+	}
+}
+
+// transform computes the 1D squared distance transform of f into d.
+func (this *transformScratch) transform(f, d []float64) {
+	v, z := this.vertices, this.boundaries
+
+	k := 0
+	v[0] = 0
+	z[0], z[1] = math.Inf(-1), math.Inf(1)
+	for q := 1; q < len(f); q++ {
+		// z[0] is -Inf, so this never backs up past the first parabola
+		s := intersectParabolas(f, q, v[k])
+		for s <= z[k] {
+			k--
+			s = intersectParabolas(f, q, v[k])
+		}
+
+		k++
+		v[k] = q
+		z[k] = s
+		z[k+1] = math.Inf(1)
+	}
+
+	k = 0
+	for q := range f {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		p := v[k]
+		d[q] = float64((q-p)*(q-p)) + f[p]
+	}
+}
+
+// intersectParabolas returns where the parabolas rooted at q and p cross.
+func intersectParabolas(f []float64, q, p int) float64 {
+	return ((f[q] + float64(q*q)) - (f[p] + float64(p*p))) / float64(2*q-2*p)
+}
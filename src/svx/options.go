@@ -0,0 +1,133 @@
+package svx
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	. "github.com/alexozer/go-mesh"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+var (
+	ErrVoxelSize = errors.New("Voxel size must be positive and finite")
+	ErrBitDepth  = errors.New("Unsupported bit depth")
+	ErrEmptyGrid = errors.New("The grid origin leaves no room for the mesh")
+)
+
+// Orientation is the axis that slices are stacked along.
+type Orientation string
+
+const (
+	OrientationX Orientation = "X"
+	OrientationY Orientation = "Y"
+	OrientationZ Orientation = "Z"
+)
+
+// axes returns the model axes that slice images run along, right then up,
+// followed by the axis slices are stacked along. The axes are always an even
+// permutation of x, y and z, so reorienting a mesh keeps its winding.
+func (this Orientation) axes() ([3]int, error) {
+	switch this {
+	case OrientationX:
+		return [3]int{1, 2, 0}, nil
+	case OrientationY:
+		return [3]int{2, 0, 1}, nil
+	case OrientationZ, "":
+		return [3]int{0, 1, 2}, nil
+	}
+	return [3]int{}, ErrOrientation
+}
+
+type MetadataEntry struct {
+	Key, Value string
+}
+
+// ExportOptions controls how meshes are voxelized and written. Only Author and
+// VoxelSize are required; every other zero value picks a sensible default.
+type ExportOptions struct {
+	Author    string
+	VoxelSize float32 // In m
+
+	// Lower corner of the grid in mm. If nil, the grid is fitted to the mesh.
+	Origin *vec3.T
+	// Empty voxels added around the grid on every side
+	Padding int
+
+	Orientation Orientation
+	// Written after the author and creation date
+	Metadata []MetadataEntry
+	// For single mesh exports. Defaults to DefaultMaterial.
+	Material Material
+
+	// Bits per density voxel, 1 or 8. Defaults to 8.
+	Bits int
+	// Planes averaged per layer of voxels; see ExportSupersampled
+	ZSamples int
+	// Which voxels count as inside. Defaults to FillPositive.
+	FillRule FillRule
+
+	// Called after each slice is written, never concurrently
+	Progress func(done, total int)
+	// Stops the export early when cancelled
+	Context context.Context
+}
+
+func (this *ExportOptions) withDefaults() (*ExportOptions, error) {
+	options := *this
+	if !(options.VoxelSize > 0) || math.IsInf(float64(options.VoxelSize), 0) {
+		return nil, ErrVoxelSize
+	}
+	if options.Bits == 0 {
+		options.Bits = 8
+	}
+	if options.Bits != 1 && options.Bits != 8 {
+		return nil, ErrBitDepth
+	}
+	if !options.FillRule.valid() {
+		return nil, ErrFillRule
+	}
+	if options.ZSamples < 1 {
+		options.ZSamples = 1
+	}
+	if options.Material == (Material{}) {
+		options.Material = DefaultMaterial
+	}
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+	if _, err := options.Orientation.axes(); err != nil {
+		return nil, err
+	}
+
+	return &options, nil
+}
+
+// orient permutes the coordinates of a mesh so that the slicing axis becomes
+// z.
+func orient(mesh ArrayBuffer, axes [3]int) ArrayBuffer {
+	if axes == [3]int{0, 1, 2} {
+		return mesh
+	}
+
+	result := make(ArrayBuffer, len(mesh))
+	for i, tri := range mesh {
+		for j, vert := range tri {
+			result[i][j] = orientPoint(vert, axes)
+		}
+	}
+	return result
+}
+
+func orientPoint(pt vec3.T, axes [3]int) vec3.T {
+	return vec3.T{pt[axes[0]], pt[axes[1]], pt[axes[2]]}
+}
+
+// unorientPoint undoes orientPoint.
+func unorientPoint(pt vec3.T, axes [3]int) vec3.T {
+	var result vec3.T
+	for i, axis := range axes {
+		result[axis] = pt[i]
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package svx
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	. "github.com/alexozer/go-mesh"
+)
+
+var ErrLayerBounds = errors.New("Layer heights must satisfy 0 < min <= max, with a positive cusp height")
+
+// LayerSchedule is a stack of layers of varying thickness, in mm.
+type LayerSchedule struct {
+	Bottom  float64   // Underside of the first layer
+	Heights []float64 // Thickness of each layer, bottom to top
+}
+
+// UniformLayers covers the mesh with layers all layerHeight thick, as
+// SliceLayers does.
+func UniformLayers(mesh ArrayBuffer, layerHeight float64) *LayerSchedule {
+	if len(mesh) == 0 || layerHeight <= 0 {
+		return &LayerSchedule{}
+	}
+
+	bounds := BoxTriangles(mesh...)
+	numLayers := int(math.Ceil((bounds.UpperBound[2] - bounds.LowerBound[2]) / layerHeight))
+	schedule := &LayerSchedule{Bottom: bounds.LowerBound[2], Heights: make([]float64, numLayers)}
+	for i := range schedule.Heights {
+		schedule.Heights[i] = layerHeight
+	}
+	return schedule
+}
+
+// AdaptiveLayers covers the mesh with layers as thick as they can be, between
+// minHeight and maxHeight, without the staircase left on sloped surfaces
+// sticking out more than maxCusp. A layer of thickness h leaves a cusp of
+// h·|n_z| on a surface with unit normal n, so steep walls get thick layers
+// and shallow slopes thin ones. Flat faces leave no staircase and are
+// ignored. The stack ends exactly at the top of the mesh: a layer is thinned
+// to leave at least minHeight above it, or stretched over what's left when
+// that is too thin to split. Only meshes thinner than minHeight, or bounds
+// with maxHeight below 2·minHeight, can end on a layer thinner than minHeight.
+func AdaptiveLayers(mesh ArrayBuffer, minHeight, maxHeight, maxCusp float64) (*LayerSchedule, error) {
+	if minHeight <= 0 || maxHeight < minHeight || maxCusp <= 0 {
+		return nil, ErrLayerBounds
+	}
+	if len(mesh) == 0 {
+		return &LayerSchedule{}, nil
+	}
+
+	// Thickest layer allowed across each sloped triangle
+	type slope struct {
+		lower, upper float64
+		maxHeight    float64
+	}
+	slopes := make([]slope, 0, len(mesh))
+	for _, tri := range mesh {
+		normal := tri.Plane().Normal
+		length := normal.Length()
+		if length == 0 {
+			continue
+		}
+		nz := math.Abs(normal[2]) / length
+		if nz == 0 || nz == 1 {
+			continue
+		}
+
+		box := BoxTriangle(tri)
+		slopes = append(slopes, slope{box.LowerBound[2], box.UpperBound[2], maxCusp / nz})
+	}
+	sort.Slice(slopes, func(i, j int) bool {
+		return slopes[i].lower < slopes[j].lower
+	})
+
+	bounds := BoxTriangles(mesh...)
+	schedule := &LayerSchedule{Bottom: bounds.LowerBound[2], Heights: make([]float64, 0)}
+
+	// Triangles that might overlap the next layer
+	active := make([]slope, 0)
+	for z, top := bounds.LowerBound[2], bounds.UpperBound[2]; top-z > 1e-9; {
+		for len(slopes) > 0 && slopes[0].lower < z+maxHeight {
+			active = append(active, slopes[0])
+			slopes = slopes[1:]
+		}
+		kept := active[:0]
+		for _, s := range active {
+			if s.upper > z {
+				kept = append(kept, s)
+			}
+		}
+		active = kept
+
+		// Thinning the layer may take it off the triangles that thinned it,
+		// so repeat until it settles
+		height := maxHeight
+		for {
+			allowed := maxHeight
+			for _, s := range active {
+				if s.lower < z+height {
+					allowed = math.Min(allowed, s.maxHeight)
+				}
+			}
+			allowed = math.Max(allowed, minHeight)
+			if allowed >= height {
+				break
+			}
+			height = allowed
+		}
+
+		// Don't leave a sliver at the top
+		remaining := top - z
+		switch {
+		case remaining <= height:
+			height = remaining
+		case remaining-height >= minHeight:
+		case remaining >= 2*minHeight:
+			height = remaining - minHeight
+		case remaining <= maxHeight:
+			height = remaining
+		default:
+			// No two layers within the bounds add up to what's left
+			height = remaining / 2
+		}
+
+		schedule.Heights = append(schedule.Heights, height)
+		z += height
+	}
+
+	return schedule, nil
+}
+
+// Len returns the number of layers.
+func (this *LayerSchedule) Len() int {
+	return len(this.Heights)
+}
+
+// Tops returns the height of the top of each layer.
+func (this *LayerSchedule) Tops() []float64 {
+	tops := make([]float64, len(this.Heights))
+	z := this.Bottom
+	for i, height := range this.Heights {
+		z += height
+		tops[i] = z
+	}
+	return tops
+}
+
+// Middles returns the height halfway through each layer, where it is sliced.
+func (this *LayerSchedule) Middles() []float64 {
+	middles := make([]float64, len(this.Heights))
+	z := this.Bottom
+	for i, height := range this.Heights {
+		middles[i] = z + height/2
+		z += height
+	}
+	return middles
+}
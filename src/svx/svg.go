@@ -0,0 +1,197 @@
+package svx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/alexozer/go-mesh"
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+var (
+	ErrLayerHeight = errors.New("Layer height must be positive")
+	ErrLayerPath   = errors.New("Per-layer paths need a %d for the layer index")
+	ErrNilSection  = errors.New("Sections must not be nil")
+)
+
+// Decimal places of mm written to SVG and DXF files
+const outlinePrecision = 4
+
+// ExportSVG writes the section of the mesh at height z to an SVG file. rule
+// must be FillEvenOdd or FillNonZero.
+func ExportSVG(mesh ArrayBuffer, path string, z float64, rule FillRule) error {
+	return writeSVGFile(path, []*Section{Slice(mesh, z)}, meshOutline(mesh), rule)
+}
+
+// ExportSVGLayers slices the whole mesh into layers layerHeight mm thick, as
+// SliceLayers does, and writes them like ExportSVGSchedule.
+func ExportSVGLayers(mesh ArrayBuffer, path string, layerHeight float64, rule FillRule, perLayer bool) error {
+	if layerHeight <= 0 {
+		return ErrLayerHeight
+	}
+	return ExportSVGSchedule(mesh, path, UniformLayers(mesh, layerHeight), rule, perLayer)
+}
+
+// ExportSVGSchedule writes the section through the middle of each layer of
+// the schedule. If perLayer is false, every layer goes into one file as its
+// own group. Otherwise path is a format containing %d, and each layer is
+// written to its own file, all sharing the same view box so they line up.
+func ExportSVGSchedule(mesh ArrayBuffer, path string, schedule *LayerSchedule, rule FillRule, perLayer bool) error {
+	if perLayer && !strings.Contains(path, "%d") {
+		return ErrLayerPath
+	}
+
+	sections := SliceSchedule(mesh, schedule)
+	outline := meshOutline(mesh)
+	if !perLayer {
+		return writeSVGFile(path, sections, outline, rule)
+	}
+
+	for i, section := range sections {
+		err := writeSVGFile(fmt.Sprintf(path, i), []*Section{section}, outline, rule)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// meshOutline returns the lower and upper corners of the mesh seen from
+// above.
+func meshOutline(mesh ArrayBuffer) [2]vec2.T {
+	if len(mesh) == 0 {
+		return [2]vec2.T{}
+	}
+
+	bounds := BoxTriangles(mesh...)
+	return [2]vec2.T{
+		{bounds.LowerBound[0], bounds.LowerBound[1]},
+		{bounds.UpperBound[0], bounds.UpperBound[1]},
+	}
+}
+
+func writeSVGFile(path string, sections []*Section, outline [2]vec2.T, rule FillRule) error {
+	// Fail before creating the file, so bad input leaves nothing behind
+	if _, err := svgFillRule(sections, rule); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = WriteSVG(file, sections, outline, rule)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteSVG writes sections as an SVG document in mm covering outline, the
+// lower and upper corners of the area to show. Each section becomes a group,
+// and each outer contour a path together with its holes. Islands inside holes
+// get paths of their own. Open chains are stroked rather than filled.
+func WriteSVG(w io.Writer, sections []*Section, outline [2]vec2.T, rule FillRule) error {
+	fillRule, err := svgFillRule(sections, rule)
+	if err != nil {
+		return err
+	}
+
+	width, height := outline[1][0]-outline[0][0], outline[1][1]-outline[0][1]
+	writer := &svgWriter{Writer: bufio.NewWriter(w), outline: outline}
+
+	fmt.Fprintf(writer, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(writer, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%smm" height="%smm" viewBox="0 0 %s %s">`+"\n",
+		formatMM(width), formatMM(height), formatMM(width), formatMM(height))
+
+	for i, section := range sections {
+		fmt.Fprintf(writer, `  <g id="layer%d" data-z="%s">`+"\n", i, formatMM(section.Z))
+
+		var walk func(contours []*Contour)
+		walk = func(contours []*Contour) {
+			for _, contour := range contours {
+				data := make([]string, 0, 1+len(contour.Children))
+				data = append(data, writer.pathData(contour.Points, true))
+				for _, hole := range contour.Children {
+					data = append(data, writer.pathData(hole.Points, true))
+				}
+				fmt.Fprintf(writer, `    <path d="%s" fill="black" fill-rule="%s"/>`+"\n", strings.Join(data, " "), fillRule)
+
+				for _, hole := range contour.Children {
+					walk(hole.Children)
+				}
+			}
+		}
+		walk(section.Contours)
+
+		for _, chain := range section.Open {
+			fmt.Fprintf(writer, `    <path d="%s" fill="none" stroke="red" stroke-width="0.1"/>`+"\n", writer.pathData(chain, false))
+		}
+
+		fmt.Fprintf(writer, "  </g>\n")
+	}
+	fmt.Fprintf(writer, "</svg>\n")
+
+	return writer.Flush()
+}
+
+// svgFillRule checks that sections and rule can be written as SVG, and
+// returns the fill-rule attribute for rule.
+func svgFillRule(sections []*Section, rule FillRule) (string, error) {
+	for _, section := range sections {
+		if section == nil {
+			return "", ErrNilSection
+		}
+	}
+
+	switch rule {
+	case FillEvenOdd:
+		return "evenodd", nil
+	case FillNonZero:
+		return "nonzero", nil
+	}
+	return "", ErrFillRule
+}
+
+type svgWriter struct {
+	*bufio.Writer
+	outline [2]vec2.T
+}
+
+// pathData converts points to SVG path commands. SVG's y axis points down, so
+// y is measured down from the top of the outline.
+func (this *svgWriter) pathData(points []vec2.T, closed bool) string {
+	commands := make([]string, 0, len(points)+1)
+	for i, pt := range points {
+		command := "L"
+		if i == 0 {
+			command = "M"
+		}
+		commands = append(commands, fmt.Sprintf("%s%s,%s", command,
+			formatMM(pt[0]-this.outline[0][0]), formatMM(this.outline[1][1]-pt[1])))
+	}
+	if closed {
+		commands = append(commands, "Z")
+	}
+	return strings.Join(commands, " ")
+}
+
+// formatMM writes a length without trailing zeros.
+func formatMM(val float64) string {
+	scale := math.Pow(10, outlinePrecision)
+	val = math.Round(val*scale) / scale
+	if val == 0 {
+		// No negative zero
+		val = 0
+	}
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
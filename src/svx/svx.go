@@ -1,93 +1,347 @@
 package svx
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"image"
-	"image/color"
-	"image/png"
-	"os"
+	"math"
+	"runtime"
 	"sort"
+	"strconv"
+	"sync"
 
 	. "github.com/alexozer/go-mesh"
-	"github.com/ungerik/go3d/vec2"
+	"github.com/ungerik/go3d/float64/vec2"
+	"github.com/ungerik/go3d/float64/vec3"
 )
 
 var ErrEmptyMesh = errors.New("Cannot export empty mesh")
 
-const dirMode = 0755
-
+// Export voxelizes the mesh into an .svx file. voxelSize is in m. Voxels on
+// the surface get densities proportional to how much of them the mesh
+// covers.
 func Export(mesh ArrayBuffer, path string, author string, voxelSize float32) error {
-	err := os.Remove(path)
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	}
+	return ExportWithOptions(mesh, path, &ExportOptions{Author: author, VoxelSize: voxelSize})
+}
 
-	// Put all the files in a temporary directory
-	buildDir := path + ".d"
-	err = os.RemoveAll(buildDir)
-	if err != nil && !os.IsNotExist(err) {
+// ExportSupersampled is like Export, but averages zSamples slices through
+// each layer of voxels, so surfaces that slope in z are anti-aliased too.
+func ExportSupersampled(mesh ArrayBuffer, path string, author string, voxelSize float32, zSamples int) error {
+	return ExportWithOptions(mesh, path, &ExportOptions{
+		Author:    author,
+		VoxelSize: voxelSize,
+		ZSamples:  zSamples,
+	})
+}
+
+// ExportWithOptions is like Export, with the grid, slicing and manifest
+// controlled by options.
+func ExportWithOptions(mesh ArrayBuffer, path string, options *ExportOptions) error {
+	options, err := options.withDefaults()
+	if err != nil {
 		return err
 	}
 
-	err = os.Mkdir(buildDir, dirMode)
+	parts := []Part{{Mesh: mesh, Material: options.Material}}
+	return exportParts(parts, path, options, false)
+}
+
+// exportParts is the common path of every export. Single mesh exports only
+// get a density channel; withMaterials adds the material and color channels.
+func exportParts(parts []Part, path string, options *ExportOptions, withMaterials bool) error {
+	materials, err := partMaterials(parts)
 	if err != nil {
 		return err
 	}
-	//defer os.RemoveAll(buildDir)
-
-	slicePath := buildDir + string(os.PathSeparator) + sliceDir
-	err = os.Mkdir(slicePath, dirMode)
+	axes, err := options.Orientation.axes()
 	if err != nil {
 		return err
 	}
 
-	if mesh.NumTriangles() == 0 {
+	partTris := make([][]BoxedTriangle, 0, len(parts))
+	allTris := make([]BoxedTriangle, 0)
+	hasColor := false
+	for _, part := range parts {
+		boxedTris := boxTriangles(orient(part.Mesh, axes))
+		partTris = append(partTris, boxedTris)
+		allTris = append(allTris, boxedTris...)
+		hasColor = hasColor || part.Color != nil
+	}
+	if len(allTris) == 0 {
 		return ErrEmptyMesh
 	}
 
-	boxedTris := boxTriangles(mesh)
-	totalBox := totalBox(boxedTris)
+	voxelSizeMM := widen(options.VoxelSize) / mmSize
+	var grid *sliceGrid
+	if options.Origin != nil {
+		grid = newSliceGridAt(orientPoint(*options.Origin, axes), totalBox(allTris), voxelSizeMM, options.ZSamples)
+	} else {
+		grid = newSliceGrid(totalBox(allTris), voxelSizeMM, options.ZSamples)
+	}
+	grid.pad(options.Padding)
+	grid.fillRule = options.FillRule
+	if grid.empty() {
+		return ErrEmptyGrid
+	}
 
-	// The model is in mm, but voxelSize is in m, so convert to mm
-	voxelSizeMM := voxelSize / mmSize
+	writer := &sliceWriter{
+		parts:         parts,
+		bits:          options.Bits,
+		withMaterials: withMaterials,
+		withColor:     withMaterials && hasColor,
+	}
 
-	var sliceCounter int
-	for z := totalBox.LowerBound[2]; z <= totalBox.UpperBound[2]; z += voxelSizeMM {
-		layer := newLayer(totalBox, voxelSizeMM)
-		for _, tri := range boxedTris {
-			if z > tri.LowerBound[2] && z < tri.UpperBound[2] {
-				line := zPlane(z).intersectTriangle(tri.Triangle)
-				if line == nil {
-					continue
-				}
+	var progressLock sync.Mutex
+	done := 0
 
-				layer.addLine(*line)
+	return buildArchive(path, func(buildDir string) (*manifest, error) {
+		err := rasterize(options.Context, partTris, grid, func(index int, layers []*layer) error {
+			if err := writer.write(buildDir, index, layers); err != nil {
+				return err
 			}
-		}
-		layer.fill()
 
-		sliceFilePath := slicePath + string(os.PathSeparator)
-		sliceFilePath += fmt.Sprintf(sliceFormat, sliceCounter)
-		sliceFile, err := os.Create(sliceFilePath)
+			if options.Progress != nil {
+				progressLock.Lock()
+				done++
+				options.Progress(done, grid.numSlices)
+				progressLock.Unlock()
+			}
+			return nil
+		})
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		var sizes [3]int
+		sizes[axes[0]], sizes[axes[1]], sizes[axes[2]] = grid.sizeX, grid.sizeY, grid.numSlices
+
+		manifest := newManifest(options.Author, sizes[0], sizes[1], sizes[2], options.VoxelSize)
+		manifest.SlicesOrientation = string(OrientationZ)
+		if options.Orientation != "" {
+			manifest.SlicesOrientation = string(options.Orientation)
+		}
+		manifest.SubvoxelBits = options.Bits
+		manifest.Channels[0].Bits = options.Bits
+		manifest.setOrigin(unorientPoint(grid.origin, axes))
+		for _, entry := range options.Metadata {
+			manifest.Metadata = append(manifest.Metadata, metadataEntry{Key: entry.Key, Value: entry.Value})
 		}
 
-		// DEBUG
-		if sliceCounter == 480 {
-			for _, line := range layer.planeLines {
-				fmt.Printf("%v\n", line)
+		manifest.Materials = materials
+		if withMaterials {
+			manifest.Channels = append(manifest.Channels, materialChannel)
+			if hasColor {
+				manifest.Channels = append(manifest.Channels, colorChannels[:]...)
 			}
 		}
+		return manifest, nil
+	})
+}
+
+// Voxelize rasterizes the mesh into a voxel grid in memory. Like Export, it
+// takes voxelSize in m.
+func Voxelize(mesh ArrayBuffer, voxelSize float32) (*VoxelGrid, error) {
+	if mesh.NumTriangles() == 0 {
+		return nil, ErrEmptyMesh
+	}
+
+	voxelSizeMM := widen(voxelSize) / mmSize
+	boxedTris := boxTriangles(mesh)
+	grid := newSliceGrid(totalBox(boxedTris), voxelSizeMM, 1)
+
+	voxels := NewVoxelGrid(grid.sizeX, grid.sizeY, grid.numSlices, voxelSizeMM, grid.origin)
+	err := rasterize(context.Background(), [][]BoxedTriangle{boxedTris}, grid, func(index int, layers []*layer) error {
+		// Every layer has its own z, so workers never write the same voxels
+		voxels.setLayer(index, layers[0])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return voxels, nil
+}
+
+// sliceGrid is the grid of voxels that a mesh is rasterized into.
+type sliceGrid struct {
+	origin       vec3.T // Lower corner of voxel (0, 0, 0) in mm
+	sizeX, sizeY int
+	numSlices    int
+	voxelSizeMM  float64
+	zSamples     int // Planes sampled per layer of voxels
+	fillRule     FillRule
+}
 
-		png.Encode(sliceFile, layer.Img)
-		sliceFile.Close()
+// newSliceGrid fits a grid around bounds. In x and y, voxel boundaries are
+// kept at multiples of the voxel size.
+func newSliceGrid(bounds *Box, voxelSizeMM float64, zSamples int) *sliceGrid {
+	lowerX := math.Floor(bounds.LowerBound[0] / voxelSizeMM)
+	lowerY := math.Floor(bounds.LowerBound[1] / voxelSizeMM)
+
+	return &sliceGrid{
+		origin:      vec3.T{lowerX * voxelSizeMM, lowerY * voxelSizeMM, bounds.LowerBound[2]},
+		sizeX:       int(math.Ceil(bounds.UpperBound[0]/voxelSizeMM) - lowerX),
+		sizeY:       int(math.Ceil(bounds.UpperBound[1]/voxelSizeMM) - lowerY),
+		numSlices:   int(math.Ceil((bounds.UpperBound[2] - bounds.LowerBound[2]) / voxelSizeMM)),
+		voxelSizeMM: voxelSizeMM,
+		zSamples:    zSamples,
+	}
+}
 
-		sliceCounter++
+// newSliceGridAt makes a grid whose lower corner is origin, reaching far
+// enough to cover bounds.
+func newSliceGridAt(origin vec3.T, bounds *Box, voxelSizeMM float64, zSamples int) *sliceGrid {
+	var sizes [3]int
+	for i := range sizes {
+		sizes[i] = int(math.Ceil((bounds.UpperBound[i] - origin[i]) / voxelSizeMM))
 	}
 
-	return nil
+	return &sliceGrid{
+		origin:      origin,
+		sizeX:       sizes[0],
+		sizeY:       sizes[1],
+		numSlices:   sizes[2],
+		voxelSizeMM: voxelSizeMM,
+		zSamples:    zSamples,
+	}
+}
+
+// pad grows the grid by n empty voxels on every side.
+func (this *sliceGrid) pad(n int) {
+	for i := range this.origin {
+		this.origin[i] -= float64(n) * this.voxelSizeMM
+	}
+	this.sizeX += 2 * n
+	this.sizeY += 2 * n
+	this.numSlices += 2 * n
+}
+
+func (this *sliceGrid) empty() bool {
+	return this.sizeX <= 0 || this.sizeY <= 0 || this.numSlices <= 0
+}
+
+// sampleZ returns the height of one of the planes sampled for a slice. The
+// planes are spread evenly through the layer of voxels, so a single plane
+// lies in the middle.
+func (this *sliceGrid) sampleZ(index, sample int) float64 {
+	offset := (float64(sample) + 0.5) / float64(this.zSamples)
+	return this.origin[2] + (float64(index)+offset)*this.voxelSizeMM
+}
+
+// rasterize fills one layer per part for each slice of the grid and hands
+// them to consume. Layers are rendered concurrently, so consume must be safe
+// to call from several goroutines at once. The job queue is bounded so only a
+// few layers' worth of triangles are held in memory at once.
+func rasterize(ctx context.Context, parts [][]BoxedTriangle, grid *sliceGrid, consume func(index int, layers []*layer) error) error {
+	numWorkers := runtime.NumCPU()
+	jobs := make(chan sliceJob, numWorkers)
+	done := make(chan struct{})
+
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := consume(job.index, job.render(grid)); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	// FillWinding reads every triangle of a part through its tree, the other
+	// rules only the triangles a sweep finds crossing each slice
+	var sweeps []*zSweep
+	var trees []*windingTree
+	for _, boxedTris := range parts {
+		if grid.fillRule == FillWinding {
+			trees = append(trees, newWindingTree(boxedTris))
+		} else {
+			sweeps = append(sweeps, newZSweep(boxedTris))
+		}
+	}
+
+produce:
+	for i := 0; i < grid.numSlices; i++ {
+		job := sliceJob{
+			index: i,
+			parts: make([][]BoxedTriangle, len(parts)),
+			trees: trees,
+		}
+		for part, sweep := range sweeps {
+			tris := sweep.advance(grid.sampleZ(i, 0), grid.sampleZ(i, grid.zSamples-1))
+			job.parts[part] = append([]BoxedTriangle(nil), tris...)
+		}
+
+		select {
+		case jobs <- job:
+		case <-done:
+			break produce
+		case <-ctx.Done():
+			fail(ctx.Err())
+			break produce
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+type sliceJob struct {
+	index int
+	parts [][]BoxedTriangle // Triangles crossing the slice, by part
+	trees []*windingTree    // Every triangle of each part, for FillWinding
+}
+
+// render samples the layer's slab at grid.zSamples evenly spaced heights and
+// averages the coverage, separately for each part.
+func (this *sliceJob) render(grid *sliceGrid) []*layer {
+	layers := make([]*layer, len(this.parts))
+	for i, tris := range this.parts {
+		layer := newLayer(grid)
+		for sample := 0; sample < grid.zSamples; sample++ {
+			if grid.fillRule == FillWinding {
+				layer.fillWinding(this.trees[i], grid.sampleZ(this.index, sample), 1/float64(grid.zSamples))
+				continue
+			}
+
+			z := zPlane(grid.sampleZ(this.index, sample))
+
+			layer.planeLines = layer.planeLines[:0]
+			for _, tri := range tris {
+				line := z.intersectTriangle(tri.Triangle)
+				if line == nil {
+					continue
+				}
+
+				layer.addLine(*line)
+			}
+			layer.fill(grid.fillRule, 1/float64(grid.zSamples))
+		}
+		layer.finish()
+
+		layers[i] = layer
+	}
+
+	return layers
+}
+
+// widen converts f to float64 without float32 rounding noise, so 1e-4
+// becomes 1e-4 rather than 1.0000000474974513e-4.
+func widen(f float32) float64 {
+	val, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	return val
 }
 
 func boxTriangles(mesh ArrayBuffer) []BoxedTriangle {
@@ -96,7 +350,7 @@ func boxTriangles(mesh ArrayBuffer) []BoxedTriangle {
 	for i := range mesh {
 		tri := mesh[i]
 		box := BoxTriangle(tri)
-		boxedTris[i] = BoxedTriangle{&tri, box}
+		boxedTris[i] = BoxedTriangle{Triangle: &tri, Box: box}
 	}
 
 	return boxedTris
@@ -116,7 +370,7 @@ func totalBox(boxedTris []BoxedTriangle) *Box {
 	return &initBbox
 }
 
-type zPlane float32 // Z-intercept
+type zPlane float64 // Z-intercept
 
 type planeLine [2]vec2.T
 
@@ -152,7 +406,13 @@ func (this zPlane) intersectTriangle(tri *Triangle) *planeLine {
 }
 
 func (this zPlane) intersectLine(line *Line) *vec2.T {
-	z := float32(this)
+	// Always interpolate from the lower endpoint so that the two triangles
+	// sharing an edge produce bit-identical points.
+	if line[0][2] > line[1][2] {
+		line = &Line{line[1], line[0]}
+	}
+
+	z := float64(this)
 	scale := (z - line[0][2]) / (line[1][2] - line[0][2])
 	x := scale*(line[1][0]-line[0][0]) + line[0][0]
 	y := scale*(line[1][1]-line[0][1]) + line[0][1]
@@ -160,18 +420,20 @@ func (this zPlane) intersectLine(line *Line) *vec2.T {
 	return &vec2.T{x, y}
 }
 
+// intersectsLine treats points lying exactly on the plane as above it, so a
+// triangle touching the plane at a vertex yields either zero or two crossings.
 func (this zPlane) intersectsLine(line *Line) bool {
-	zVal := float32(this)
-	return (zVal > line[0][2] && zVal < line[1][2]) ||
-		(zVal > line[1][2] && zVal < line[0][2])
+	zVal := float64(this)
+	return (line[0][2] >= zVal) != (line[1][2] >= zVal)
 }
 
-func (this *planeLine) intersectsHorizLine(y, voxelSizeMM float32) bool {
-	return (y >= this[0][1] && y <= this[1][1]) ||
-		(y >= this[1][1] && y <= this[0][1])
+// intersectsHorizLine uses the same half-open rule as zPlane.intersectsLine,
+// so horizontal lines never intersect and shared endpoints are counted once.
+func (this *planeLine) intersectsHorizLine(y float64) bool {
+	return (this[0][1] >= y) != (this[1][1] >= y)
 }
 
-func (this *planeLine) intersectHorizLine(y float32) (x float32) {
+func (this *planeLine) intersectHorizLine(y float64) (x float64) {
 	deltaX := this[1][0] - this[0][0]
 	deltaY := this[1][1] - this[0][1]
 	dy := this[0][1] - y
@@ -184,23 +446,25 @@ func (this *planeLine) pointsUp() bool {
 }
 
 type layer struct {
-	Img        *image.NRGBA
-	VoxelSize  float32
+	Img        *image.Gray
+	VoxelSize  float64
+	Origin     vec2.T // Lower left corner of the layer in mm
 	planeLines []planeLine
+	coverage   []float64 // Covered fraction of each voxel, rows bottom to top
 }
 
 const mmSize = 1e-3
 
-func newLayer(bounds *Box, voxelSize float32) *layer {
+// Scanlines sampled per row of voxels
+const rowSamples = 4
+
+func newLayer(grid *sliceGrid) *layer {
 	return &layer{
-		Img: image.NewNRGBA(image.Rect(
-			int(bounds.LowerBound[0]/voxelSize),
-			int(bounds.LowerBound[1]/voxelSize),
-			int(bounds.UpperBound[0]/voxelSize),
-			int(bounds.UpperBound[1]/voxelSize),
-		)),
-		VoxelSize:  voxelSize,
+		Img:        image.NewGray(image.Rect(0, 0, grid.sizeX, grid.sizeY)),
+		VoxelSize:  grid.voxelSizeMM,
+		Origin:     vec2.T{grid.origin[0], grid.origin[1]},
 		planeLines: make([]planeLine, 0),
+		coverage:   make([]float64, grid.sizeX*grid.sizeY),
 	}
 }
 
@@ -209,7 +473,7 @@ func (this *layer) addLine(line planeLine) {
 }
 
 type intercept struct {
-	X        float32
+	X        float64
 	PointsUp bool
 }
 
@@ -227,42 +491,66 @@ func (this intercepts) Swap(i, j int) {
 	this[i], this[j] = this[j], this[i]
 }
 
-func (this *layer) fill() {
-	bounds := this.Img.Bounds()
-	for imgY := bounds.Min.Y; imgY <= bounds.Max.Y; imgY++ {
-		planeY := float32(imgY) * this.VoxelSize
-		intercepts := make(intercepts, 0)
-
-		for _, line := range this.planeLines {
-			if !line.intersectsHorizLine(planeY, this.VoxelSize) {
-				continue
-			}
+// fill adds the area the layer's lines enclose under rule to the voxel
+// coverage, scaled by weight. Each row of voxels is sampled by several scanlines, and
+// each scanline adds the exact length of every voxel it crosses inside the
+// mesh.
+func (this *layer) fill(rule FillRule, weight float64) {
+	for imgY := 0; imgY < this.Img.Rect.Dy(); imgY++ {
+		for sample := 0; sample < rowSamples; sample++ {
+			planeY := this.Origin[1] + (float64(imgY)+(float64(sample)+0.5)/rowSamples)*this.VoxelSize
+			intercepts := make(intercepts, 0)
+
+			for _, line := range this.planeLines {
+				if !line.intersectsHorizLine(planeY) {
+					continue
+				}
 
-			intercepts = append(intercepts, intercept{
-				line.intersectHorizLine(planeY),
-				line.pointsUp(),
-			})
-		}
-		sort.Sort(intercepts)
-
-		var depth int
-		for i, intercept := range intercepts {
-			if !intercept.PointsUp {
-				depth++
-			} else {
-				depth--
+				intercepts = append(intercepts, intercept{
+					line.intersectHorizLine(planeY),
+					line.pointsUp(),
+				})
 			}
-			if i+1 < len(intercepts) && depth > 0 {
-				imgX0, imgX1 := int(intercept.X/this.VoxelSize), int(intercepts[i+1].X/this.VoxelSize)
-				this.fillStrip(imgX0, imgX1, imgY)
+			sort.Sort(intercepts)
+
+			var depth int
+			for i, intercept := range intercepts {
+				if !intercept.PointsUp {
+					depth++
+				} else {
+					depth--
+				}
+				if i+1 < len(intercepts) && rule.inside(depth, i+1) {
+					this.fillStrip(intercept.X, intercepts[i+1].X, imgY, weight/rowSamples)
+				}
 			}
 		}
 	}
 }
 
-func (this *layer) fillStrip(imgX0, imgX1, imgY int) {
-	realImgY := this.Img.Rect.Max.Y - imgY + this.Img.Rect.Min.Y
-	for x := imgX0; x <= imgX1; x++ {
-		this.Img.Set(x, realImgY, color.NRGBA{255, 255, 255, 255})
+// fillStrip covers the row of voxels at imgY from plane x0 to x1.
+func (this *layer) fillStrip(x0, x1 float64, imgY int, weight float64) {
+	width := this.Img.Rect.Dx()
+	row := this.coverage[imgY*width:][:width]
+
+	// In voxels from the left edge of the layer
+	u0 := math.Max(0, (x0-this.Origin[0])/this.VoxelSize)
+	u1 := math.Min(float64(width), (x1-this.Origin[0])/this.VoxelSize)
+	for x := int(u0); float64(x) < u1; x++ {
+		overlap := math.Min(u1, float64(x+1)) - math.Max(u0, float64(x))
+		row[x] += overlap * weight
+	}
+}
+
+// finish converts the accumulated coverage into image densities.
+func (this *layer) finish() {
+	rect := this.Img.Rect
+	width := rect.Dx()
+	for y := 0; y < rect.Dy(); y++ {
+		// Image rows run top to bottom, but plane y runs bottom to top
+		pixels := this.Img.Pix[(rect.Dy()-1-y)*this.Img.Stride:][:width]
+		for x, coverage := range this.coverage[y*width:][:width] {
+			pixels[x] = uint8(math.Floor(255*math.Max(0, math.Min(1, coverage)) + 0.5))
+		}
 	}
 }
@@ -1,21 +1,33 @@
 package svx
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
 	"fmt"
 	"image"
+	"image/color"
 	"image/png"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/alexozer/go-mesh"
-	"github.com/ungerik/go3d/vec2"
-	"github.com/ungerik/go3d/vec3"
+	"github.com/ungerik/go3d/float64/vec2"
+	"github.com/ungerik/go3d/float64/vec3"
 )
 
+const helixPath = "../resources/helix.stl"
+
 func newAbuf(t *testing.T) mesh.ArrayBuffer {
-	stl, err := mesh.NewStlFile("../resources/helix.stl")
+	stl, err := mesh.NewStlFile(helixPath)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("Loading test model %s: %v", helixPath, err)
 	}
 
 	abuf := mesh.ArrayBuffer{}
@@ -37,7 +49,7 @@ func TestManifest(t *testing.T) {
 }
 
 func TestFill(t *testing.T) {
-	layer := newLayer(&mesh.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, voxelSize)
+	layer := newLayer(newSliceGrid(&mesh.Box{LowerBound: vec3.T{0, 0, 0}, UpperBound: vec3.T{1, 1, 1}}, voxelSize, 1))
 
 	tri0, tri1, tri2 := vec2.T{0.25, 0.25}, vec2.T{0.75, 0.25}, vec2.T{0.5, 0.75}
 	sq0, sq1, sq2, sq3 := vec2.T{0.3, 0.3}, vec2.T{0.7, 0.3}, vec2.T{0.7, 0.7}, vec2.T{0.3, 0.7}
@@ -59,7 +71,8 @@ func TestFill(t *testing.T) {
 	layer.addLine(planeLine{sq2, sq3})
 	layer.addLine(planeLine{sq3, sq0})
 
-	layer.fill()
+	layer.fill(FillPositive, 1)
+	layer.finish()
 
 	os.Remove(tmpImage)
 	file, err := os.Create(tmpImage)
@@ -123,3 +136,1312 @@ func TestIntersectLine(t *testing.T) {
 
 	fmt.Println(zPlane(50).intersectLine(line))
 }
+
+// boxMesh returns the outward-facing triangles of an axis-aligned box.
+func boxMesh(lower, upper vec3.T) mesh.ArrayBuffer {
+	var corners [8]vec3.T
+	for i := range corners {
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<uint(axis)) == 0 {
+				corners[i][axis] = lower[axis]
+			} else {
+				corners[i][axis] = upper[axis]
+			}
+		}
+	}
+
+	faces := [12][3]int{
+		{0, 2, 3}, {0, 3, 1}, // -z
+		{4, 5, 7}, {4, 7, 6}, // +z
+		{0, 1, 5}, {0, 5, 4}, // -y
+		{2, 6, 7}, {2, 7, 3}, // +y
+		{0, 4, 6}, {0, 6, 2}, // -x
+		{1, 3, 7}, {1, 7, 5}, // +x
+	}
+
+	abuf := make(mesh.ArrayBuffer, len(faces))
+	for i, face := range faces {
+		abuf[i] = mesh.Triangle{corners[face[0]], corners[face[1]], corners[face[2]]}
+	}
+	return abuf
+}
+
+// hollowBox returns a box of the given size with a cubic cavity in the middle.
+func hollowBox(size, wall float64) mesh.ArrayBuffer {
+	abuf := boxMesh(vec3.T{0, 0, 0}, vec3.T{size, size, size})
+	cavity := boxMesh(vec3.T{wall, wall, wall}, vec3.T{size - wall, size - wall, size - wall})
+	for _, tri := range cavity {
+		abuf = append(abuf, mesh.Triangle{tri[0], tri[2], tri[1]})
+	}
+	return abuf
+}
+
+func TestSlice(t *testing.T) {
+	section := Slice(hollowBox(10, 2), 5)
+
+	if len(section.Open) != 0 {
+		t.Fatalf("Closed mesh produced %d open chains", len(section.Open))
+	}
+	if len(section.Contours) != 1 {
+		t.Fatalf("Expected 1 outer contour, got %d", len(section.Contours))
+	}
+
+	outer := section.Contours[0]
+	if outer.Hole || math.Abs(outer.Area()-100) > 1e-9 {
+		t.Fatalf("Bad outer contour: hole %v, area %v", outer.Hole, outer.Area())
+	}
+	if len(outer.Children) != 1 {
+		t.Fatalf("Expected 1 hole, got %d", len(outer.Children))
+	}
+
+	hole := outer.Children[0]
+	if !hole.Hole || math.Abs(hole.Area()+36) > 1e-9 {
+		t.Fatalf("Bad hole contour: hole %v, area %v", hole.Hole, hole.Area())
+	}
+}
+
+func TestSliceOpen(t *testing.T) {
+	// Drop the +x side of the box
+	leaky := boxMesh(vec3.T{0, 0, 0}, vec3.T{1, 1, 1})[:10]
+
+	section := Slice(leaky, 0.5)
+	if len(section.Contours) != 0 || len(section.Open) != 1 {
+		t.Fatalf("Expected a single open chain, got %d contours and %d chains",
+			len(section.Contours), len(section.Open))
+	}
+}
+
+func TestZSweep(t *testing.T) {
+	abuf := hollowBox(10, 2)
+	abuf = append(abuf, boxMesh(vec3.T{20, 0, 3}, vec3.T{25, 5, 7.5})...)
+	boxedTris := boxTriangles(abuf)
+
+	sweep := newZSweep(boxedTris)
+	for z := -1.0; z <= 11; z += 0.25 {
+		var expected int
+		for _, tri := range boxedTris {
+			if z > tri.LowerBound[2] && z <= tri.UpperBound[2] {
+				expected++
+			}
+		}
+
+		if active := sweep.advance(z, z); len(active) != expected {
+			t.Fatalf("At z = %v: expected %d active triangles, got %d", z, expected, len(active))
+		}
+	}
+}
+
+func TestWriteArchiveFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "old.svx")
+	if err := os.WriteFile(path, []byte("old"), fileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newManifest(author, 1, 1, 1, 1e-3)
+	if err := writeArchive(path, filepath.Join(dir, "missing"), m); err == nil {
+		t.Fatal("Expected zipping a missing directory to fail")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "old" {
+		t.Fatalf("Failed write changed the old file to %q, %v", data, err)
+	}
+
+	if err := writeArchive(path, dir, m); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "old.svx" {
+		t.Fatalf("Temporary files left behind: %v", entries)
+	}
+}
+
+func TestExportBox(t *testing.T) {
+	path := "/tmp/box.svx"
+	err := Export(boxMesh(vec3.T{0, 0, 0}, vec3.T{10, 10, 10}), path, author, 1e-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + ".d"); !os.IsNotExist(err) {
+		t.Fatal("Build directory was not cleaned up")
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	var m manifest
+	var numSlices int
+	for _, file := range archive.File {
+		if file.Name == manifestName {
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = xml.NewDecoder(reader).Decode(&m)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else if strings.HasPrefix(file.Name, sliceDir+"/") {
+			numSlices++
+		}
+	}
+
+	if m.GridSizeX != 10 || m.GridSizeY != 10 || m.GridSizeZ != 10 {
+		t.Fatalf("Wrong grid size %dx%dx%d", m.GridSizeX, m.GridSizeY, m.GridSizeZ)
+	}
+	if m.VoxelSize != 1e-3 {
+		t.Fatalf("Wrong voxel size %v", m.VoxelSize)
+	}
+	if numSlices != 10 {
+		t.Fatalf("Expected 10 slices, got %d", numSlices)
+	}
+}
+
+func TestImport(t *testing.T) {
+	path := "/tmp/hollow.svx"
+	abuf := hollowBox(10, 2)
+	for i := range abuf {
+		for j := range abuf[i] {
+			abuf[i][j][0] += 5
+		}
+	}
+
+	err := Export(abuf, path, author, 1e-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid, err := Import(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if grid.SizeX != 10 || grid.SizeY != 10 || grid.SizeZ != 10 {
+		t.Fatalf("Wrong grid size %dx%dx%d", grid.SizeX, grid.SizeY, grid.SizeZ)
+	}
+	if math.Abs(grid.VoxelSize-1) > 1e-6 || math.Abs(grid.Origin[0]-5) > 1e-6 {
+		t.Fatalf("Wrong voxel size %v or origin %v", grid.VoxelSize, grid.Origin)
+	}
+
+	var solid int
+	for _, density := range grid.Density {
+		if density == 255 {
+			solid++
+		}
+	}
+	if solid != 1000-6*6*6 {
+		t.Fatalf("Expected %d solid voxels, got %d", 1000-6*6*6, solid)
+	}
+	if grid.At(5, 5, 5) != 0 || grid.At(0, 9, 5) != 255 {
+		t.Fatal("Voxels imported in the wrong place")
+	}
+}
+
+// writeRawSVX writes an archive with the given manifest attributes and
+// slices blank slices of width by height pixels.
+func writeRawSVX(t *testing.T, path, attrs string, slices, width, height int) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+
+	w, err := archive.Create("manifest.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(w, `<grid version="1.0" %s><channels>`+
+		`<channel type="DENSITY" bits="8" slices="density/slice%%d.png"/>`+
+		`</channels></grid>`, attrs)
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := 0; i < slices; i++ {
+		w, err := archive.Create(fmt.Sprintf("density/slice%d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = png.Encode(w, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportBadManifest(t *testing.T) {
+	path := "/tmp/bad.svx"
+	cases := []struct {
+		attrs string
+		err   error
+	}{
+		{`gridSizeX="4" gridSizeY="4" gridSizeZ="2" voxelSize="0.001"`, nil},
+		{`gridSizeX="4" gridSizeY="4" gridSizeZ="2" voxelSize="0"`, ErrVoxelSize},
+		{`gridSizeX="4" gridSizeY="4" gridSizeZ="2" voxelSize="-0.001"`, ErrVoxelSize},
+		{`gridSizeX="4" gridSizeY="4" gridSizeZ="2" voxelSize="NaN"`, ErrVoxelSize},
+		{`gridSizeX="-4" gridSizeY="4" gridSizeZ="2" voxelSize="0.001"`, ErrGridSize},
+		{`gridSizeX="4" gridSizeY="4" gridSizeZ="0" voxelSize="0.001"`, ErrGridSize},
+		{`gridSizeX="4" gridSizeY="4" gridSizeZ="1000000000" voxelSize="0.001"`, ErrGridSize},
+		{`gridSizeX="1000000000" gridSizeY="4" gridSizeZ="2" voxelSize="0.001"`, ErrGridSize},
+		{`gridSizeX="65536" gridSizeY="65536" gridSizeZ="2" voxelSize="0.001"`, ErrGridSize},
+		{`gridSizeX="4" gridSizeY="5" gridSizeZ="2" voxelSize="0.001"`, ErrSliceSize},
+		{`gridSizeX="4" gridSizeY="4" gridSizeZ="3" voxelSize="0.001"`, ErrMissingSlices},
+	}
+	for _, c := range cases {
+		writeRawSVX(t, path, c.attrs, 2, 4, 4)
+		if _, err := Import(path); err != c.err {
+			t.Errorf("Importing %s: expected %v, got %v", c.attrs, c.err, err)
+		}
+	}
+}
+
+func countSolid(grid *VoxelGrid) int {
+	var solid int
+	for _, density := range grid.Density {
+		if density >= solidThreshold {
+			solid++
+		}
+	}
+	return solid
+}
+
+func TestVoxelize(t *testing.T) {
+	grid, err := Voxelize(hollowBox(10, 2), 1e-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if solid := countSolid(grid); solid != 1000-6*6*6 {
+		t.Fatalf("Expected %d solid voxels, got %d", 1000-6*6*6, solid)
+	}
+
+	path := "/tmp/voxelgrid.svx"
+	if err = grid.Export(path, author); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := Import(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(grid.Density, imported.Density) || imported.Origin != grid.Origin {
+		t.Fatal("Voxel grid changed after export and import")
+	}
+}
+
+func TestVoxelGridBooleans(t *testing.T) {
+	a := NewVoxelGrid(4, 4, 4, 1, vec3.T{0, 0, 0})
+	b := NewVoxelGrid(4, 4, 4, 1, vec3.T{2, 0, 0})
+	for i := range a.Density {
+		a.Density[i] = 255
+		b.Density[i] = 255
+	}
+
+	union, err := a.Union(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if union.SizeX != 6 || countSolid(union) != 6*4*4 {
+		t.Fatalf("Bad union: %d wide, %d solid", union.SizeX, countSolid(union))
+	}
+
+	intersection, _ := a.Intersection(b)
+	if countSolid(intersection) != 2*4*4 {
+		t.Fatalf("Bad intersection: %d solid", countSolid(intersection))
+	}
+
+	difference, _ := a.Difference(b)
+	if countSolid(difference) != 2*4*4 || difference.At(3, 0, 0) != 0 {
+		t.Fatalf("Bad difference: %d solid", countSolid(difference))
+	}
+
+	misaligned := NewVoxelGrid(4, 4, 4, 1, vec3.T{0.5, 0, 0})
+	if _, err = a.Union(misaligned); err != ErrGridMismatch {
+		t.Fatal("Misaligned grids were combined")
+	}
+}
+
+func TestVoxelGridMorphology(t *testing.T) {
+	grid := NewVoxelGrid(9, 9, 9, 0.5, vec3.T{0, 0, 0})
+	grid.Set(4, 4, 4, 255)
+
+	// A sphere of radius 2 voxels
+	dilated := grid.Dilate(1)
+	if dilated.SizeX != 13 || countSolid(dilated) != 33 {
+		t.Fatalf("Bad dilation: %d wide, %d solid", dilated.SizeX, countSolid(dilated))
+	}
+
+	cube := NewVoxelGrid(10, 10, 10, 1, vec3.T{0, 0, 0})
+	for i := range cube.Density {
+		cube.Density[i] = 255
+	}
+
+	eroded := cube.Erode(2)
+	if countSolid(eroded) != 6*6*6 || eroded.At(2, 2, 2) != 255 || eroded.At(1, 5, 5) != 0 {
+		t.Fatalf("Bad erosion: %d solid", countSolid(eroded))
+	}
+
+	hollow := cube.Hollow(2)
+	if countSolid(hollow) != 1000-6*6*6 || hollow.At(5, 5, 5) != 0 {
+		t.Fatalf("Bad hollowing: %d solid", countSolid(hollow))
+	}
+}
+
+// checkClosed fails unless every edge of the mesh is shared by exactly two
+// faces that traverse it in opposite directions.
+func checkClosed(t *testing.T, ibuf *mesh.IndexBuffer) {
+	edges := make(map[[2]uint32]int)
+	for _, face := range ibuf.Faces {
+		for i := 0; i < 3; i++ {
+			edges[[2]uint32{face[i], face[(i+1)%3]}]++
+		}
+	}
+
+	for edge, count := range edges {
+		if count != 1 || edges[[2]uint32{edge[1], edge[0]}] != 1 {
+			t.Fatalf("Edge %v is not shared by two consistently wound faces", edge)
+		}
+	}
+}
+
+func signedVolume(ibuf *mesh.IndexBuffer) float64 {
+	var volume float64
+	for _, face := range ibuf.Faces {
+		v0, v1, v2 := ibuf.Vertices[face[0]], ibuf.Vertices[face[1]], ibuf.Vertices[face[2]]
+		cross := vec3.Cross(&v1, &v2)
+		volume += vec3.Dot(&v0, &cross) / 6
+	}
+	return volume
+}
+
+func TestExtractSurface(t *testing.T) {
+	grid, err := Voxelize(boxMesh(vec3.T{0, 0, 0}, vec3.T{10, 10, 10}), 1e-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ibuf := ExtractSurface(grid, solidThreshold)
+	checkClosed(t, ibuf)
+
+	// Dual contouring should recover the sharp box almost exactly
+	if volume := signedVolume(ibuf); math.Abs(volume-1000) > 10 {
+		t.Fatalf("Expected a volume near 1000, got %v", volume)
+	}
+
+	hollow := ExtractSurface(grid.Hollow(2), solidThreshold)
+	checkClosed(t, hollow)
+	if volume := signedVolume(hollow); math.Abs(volume-(1000-216)) > 20 {
+		t.Fatalf("Expected a volume near %v, got %v", 1000-216, volume)
+	}
+}
+
+func TestExtractSphere(t *testing.T) {
+	const radius = 10
+	grid := NewVoxelGrid(24, 24, 24, 1, vec3.T{-12, -12, -12})
+	for z := 0; z < grid.SizeZ; z++ {
+		for y := 0; y < grid.SizeY; y++ {
+			for x := 0; x < grid.SizeX; x++ {
+				center := grid.Center(x, y, z)
+				dist := center.Length() - radius
+
+				// Smooth density ramp across the surface
+				density := math.Max(0, math.Min(255, 127.5-dist*127.5))
+				grid.Set(x, y, z, uint8(density))
+			}
+		}
+	}
+
+	ibuf := ExtractSurface(grid, 127.5)
+	checkClosed(t, ibuf)
+
+	expected := 4.0 / 3 * math.Pi * radius * radius * radius
+	if volume := signedVolume(ibuf); math.Abs(volume-expected) > 0.02*expected {
+		t.Fatalf("Expected a volume near %v, got %v", expected, volume)
+	}
+}
+
+func TestAntialiasing(t *testing.T) {
+	box := boxMesh(vec3.T{0.25, 0, 0}, vec3.T{9.75, 10, 9.5})
+
+	path := "/tmp/antialiased.svx"
+	if err := ExportSupersampled(box, path, author, 1e-3, 4); err != nil {
+		t.Fatal(err)
+	}
+	grid, err := Import(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Boundary voxels are three quarters covered in x
+	if grid.At(0, 5, 5) != 191 || grid.At(9, 5, 5) != 191 || grid.At(5, 5, 5) != 255 {
+		t.Fatalf("Bad densities across x: %v %v %v", grid.At(0, 5, 5), grid.At(5, 5, 5), grid.At(9, 5, 5))
+	}
+
+	// The top layer only gets half the z samples
+	if grid.SizeZ != 10 || grid.At(5, 5, 9) != 128 {
+		t.Fatalf("Expected a half-dense top layer, got %v", grid.At(5, 5, 9))
+	}
+}
+
+// archiveImage decodes an image stored in an .svx file.
+func archiveImage(t *testing.T, path, name string) image.Image {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name == name {
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			img, err := png.Decode(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return img
+		}
+	}
+
+	t.Fatalf("%s has no %s", path, name)
+	return nil
+}
+
+func TestExportParts(t *testing.T) {
+	red := Material{Id: 2, Urn: "urn:shapeways:materials/2"}
+	parts := []Part{
+		{Mesh: boxMesh(vec3.T{0, 0, 0}, vec3.T{5, 10, 10}), Material: DefaultMaterial},
+		{Mesh: boxMesh(vec3.T{5, 0, 0}, vec3.T{10, 10, 10}), Material: red, Color: color.RGBA{255, 0, 0, 255}},
+	}
+
+	path := "/tmp/parts.svx"
+	if err := ExportParts(parts, path, author, 1e-3); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(archive.File[0])
+	archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Channels) != 5 || len(m.Materials) != 2 || m.channel("MATERIAL") == nil {
+		t.Fatalf("Bad manifest channels %v and materials %v", m.Channels, m.Materials)
+	}
+
+	materials := archiveImage(t, path, "material/slice5.png")
+	reds := archiveImage(t, path, "color_r/slice5.png")
+	greens := archiveImage(t, path, "color_g/slice5.png")
+	for _, c := range []struct {
+		x              int
+		material, r, g uint8
+	}{
+		{2, 1, 255, 255}, // The first part has no color, so is white
+		{7, 2, 255, 0},
+	} {
+		gray := func(img image.Image) uint8 {
+			return color.GrayModel.Convert(img.At(c.x, 5)).(color.Gray).Y
+		}
+		if gray(materials) != c.material || gray(reds) != c.r || gray(greens) != c.g {
+			t.Fatalf("Wrong material or color at x = %d", c.x)
+		}
+	}
+
+	parts[1].Material.Id = 1
+	if err := ExportParts(parts, path, author, 1e-3); err != ErrDuplicateMaterial {
+		t.Fatal("Conflicting material URNs were accepted")
+	}
+}
+
+func archiveManifest(t *testing.T, path string) *manifest {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name == manifestName {
+			m, err := readManifest(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return m
+		}
+	}
+
+	t.Fatalf("%s has no manifest", path)
+	return nil
+}
+
+func TestExportOptions(t *testing.T) {
+	path := "/tmp/options.svx"
+	box := boxMesh(vec3.T{0, 0, 0}, vec3.T{4, 6, 8})
+
+	for _, orientation := range []Orientation{OrientationX, OrientationY, OrientationZ} {
+		var calls, lastDone, lastTotal int
+		err := ExportWithOptions(box, path, &ExportOptions{
+			Author:      author,
+			VoxelSize:   1e-3,
+			Padding:     1,
+			Orientation: orientation,
+			Metadata:    []MetadataEntry{{Key: "printer", Value: "test"}},
+			Progress: func(done, total int) {
+				calls++
+				lastDone, lastTotal = done, total
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		grid, err := Import(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if grid.SizeX != 6 || grid.SizeY != 8 || grid.SizeZ != 10 {
+			t.Fatalf("%s: wrong grid size %dx%dx%d", orientation, grid.SizeX, grid.SizeY, grid.SizeZ)
+		}
+		if expected := (vec3.T{-1, -1, -1}); vec3.Distance(&grid.Origin, &expected) > 1e-6 {
+			t.Fatalf("%s: wrong origin %v", orientation, grid.Origin)
+		}
+		if countSolid(grid) != 4*6*8 || grid.At(0, 0, 0) != 0 || grid.At(1, 1, 1) != 255 || grid.At(4, 6, 8) != 255 {
+			t.Fatalf("%s: voxels imported in the wrong place", orientation)
+		}
+
+		sizes := map[Orientation]int{OrientationX: 6, OrientationY: 8, OrientationZ: 10}
+		if calls != sizes[orientation] || lastDone != lastTotal || lastTotal != calls {
+			t.Fatalf("%s: progress called %d times, last %d/%d", orientation, calls, lastDone, lastTotal)
+		}
+
+		m := archiveManifest(t, path)
+		if m.SlicesOrientation != string(orientation) {
+			t.Fatalf("Wrong orientation %s", m.SlicesOrientation)
+		}
+		last := m.Metadata[len(m.Metadata)-1]
+		if last.Key != "printer" || last.Value != "test" {
+			t.Fatalf("Custom metadata missing: %v", m.Metadata)
+		}
+	}
+}
+
+func TestExportOrigin(t *testing.T) {
+	path := "/tmp/origin.svx"
+	box := boxMesh(vec3.T{0, 0, 0}, vec3.T{4, 6, 8})
+
+	err := ExportWithOptions(box, path, &ExportOptions{
+		Author:    author,
+		VoxelSize: 1e-3,
+		Origin:    &vec3.T{-2, 0, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid, err := Import(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grid.SizeX != 6 || grid.SizeY != 6 || grid.SizeZ != 8 || grid.Origin[0] != -2 {
+		t.Fatalf("Wrong grid %dx%dx%d at %v", grid.SizeX, grid.SizeY, grid.SizeZ, grid.Origin)
+	}
+	if grid.At(1, 0, 0) != 0 || grid.At(2, 0, 0) != 255 {
+		t.Fatal("Mesh not placed relative to the origin")
+	}
+
+	err = ExportWithOptions(box, path, &ExportOptions{
+		Author:    author,
+		VoxelSize: 1e-3,
+		Origin:    &vec3.T{10, 0, 0},
+	})
+	if err != ErrEmptyGrid {
+		t.Fatalf("Expected ErrEmptyGrid, got %v", err)
+	}
+}
+
+func TestExportBits(t *testing.T) {
+	path := "/tmp/bits.svx"
+	// Half a voxel of the top layer is covered
+	box := boxMesh(vec3.T{0, 0, 0}, vec3.T{4, 4, 3.5})
+
+	err := ExportWithOptions(box, path, &ExportOptions{Author: author, VoxelSize: 1e-3, Bits: 1, ZSamples: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, ok := archiveImage(t, path, "density/slice3.png").(*image.Paletted)
+	if !ok || len(img.Palette) != 2 {
+		t.Fatal("Expected a two color slice")
+	}
+	if gray := color.GrayModel.Convert(img.At(0, 0)).(color.Gray); gray.Y != 255 {
+		t.Fatalf("Half covered voxel should round up, got %d", gray.Y)
+	}
+	if m := archiveManifest(t, path); m.Channels[0].Bits != 1 {
+		t.Fatalf("Wrong channel bits %d", m.Channels[0].Bits)
+	}
+
+	err = ExportWithOptions(box, path, &ExportOptions{Author: author, VoxelSize: 1e-3, Bits: 4})
+	if err != ErrBitDepth {
+		t.Fatalf("Expected ErrBitDepth, got %v", err)
+	}
+
+	for _, voxelSize := range []float64{0, -1e-3, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		err = ExportWithOptions(box, path, &ExportOptions{Author: author, VoxelSize: float32(voxelSize)})
+		if err != ErrVoxelSize {
+			t.Fatalf("Voxel size %v: expected ErrVoxelSize, got %v", voxelSize, err)
+		}
+	}
+}
+
+func TestExportCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ExportWithOptions(boxMesh(vec3.T{0, 0, 0}, vec3.T{10, 10, 100}), "/tmp/cancel.svx", &ExportOptions{
+		Author:    author,
+		VoxelSize: 1e-4,
+		Context:   ctx,
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat("/tmp/cancel.svx"); !os.IsNotExist(err) {
+		t.Fatal("Cancelled export left a file behind")
+	}
+}
+
+func exportWithRule(t *testing.T, abuf mesh.ArrayBuffer, rule FillRule) *VoxelGrid {
+	path := "/tmp/fillrule.svx"
+	err := ExportWithOptions(abuf, path, &ExportOptions{Author: author, VoxelSize: 1e-3, FillRule: rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid, err := Import(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return grid
+}
+
+func reversed(abuf mesh.ArrayBuffer) mesh.ArrayBuffer {
+	result := make(mesh.ArrayBuffer, len(abuf))
+	for i, tri := range abuf {
+		result[i] = mesh.Triangle{tri[0], tri[2], tri[1]}
+	}
+	return result
+}
+
+func TestFillRules(t *testing.T) {
+	box := boxMesh(vec3.T{0, 0, 0}, vec3.T{4, 4, 4})
+	overlapping := append(boxMesh(vec3.T{0, 0, 0}, vec3.T{3, 4, 4}), boxMesh(vec3.T{1, 0, 0}, vec3.T{4, 4, 4})...)
+
+	// Without its +x side
+	open := make(mesh.ArrayBuffer, 0)
+	for _, tri := range box {
+		if tri[0][0] != 4 || tri[1][0] != 4 || tri[2][0] != 4 {
+			open = append(open, tri)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		abuf  mesh.ArrayBuffer
+		rule  FillRule
+		solid int
+	}{
+		{"positive overlapping", overlapping, FillPositive, 64},
+		{"positive reversed", reversed(box), FillPositive, 0},
+		{"even-odd overlapping", overlapping, FillEvenOdd, 32},
+		{"even-odd reversed", reversed(box), FillEvenOdd, 64},
+		{"nonzero overlapping", overlapping, FillNonZero, 64},
+		{"nonzero reversed", reversed(box), FillNonZero, 64},
+		{"winding overlapping", overlapping, FillWinding, 64},
+		{"winding reversed", reversed(box), FillWinding, 64},
+		{"winding open", open, FillWinding, 64},
+	}
+
+	for _, c := range cases {
+		if solid := countSolid(exportWithRule(t, c.abuf, c.rule)); solid != c.solid {
+			t.Errorf("%s: expected %d solid voxels, got %d", c.name, c.solid, solid)
+		}
+	}
+
+	err := ExportWithOptions(box, "/tmp/fillrule.svx", &ExportOptions{Author: author, VoxelSize: 1e-3, FillRule: 7})
+	if err != ErrFillRule {
+		t.Fatalf("Expected ErrFillRule, got %v", err)
+	}
+}
+
+func TestWindingTree(t *testing.T) {
+	boxedTris := boxTriangles(newAbuf(t))
+	tree := newWindingTree(boxedTris)
+	box := totalBox(boxedTris)
+
+	// Compare with the exact sum on a grid running past the helix
+	const steps = 12
+	for i := 0; i <= steps; i++ {
+		for j := 0; j <= steps; j++ {
+			for k := 0; k <= steps; k++ {
+				var pt vec3.T
+				for axis, step := range [3]int{i, j, k} {
+					low, high := box.LowerBound[axis]-1, box.UpperBound[axis]+1
+					pt[axis] = low + (high-low)*float64(step)/steps
+				}
+
+				var exact float64
+				for _, boxedTri := range boxedTris {
+					exact += solidAngle(boxedTri.Triangle, &pt)
+				}
+				exact /= 4 * math.Pi
+				if approx := tree.windingNumber(&pt); math.Abs(approx-exact) > 0.02 {
+					t.Fatalf("Winding number at %v is %v, expected %v", pt, approx, exact)
+				}
+			}
+		}
+	}
+
+	if empty := newWindingTree(nil); empty.windingNumber(&vec3.T{}) != 0 {
+		t.Fatal("Empty tree winds around the origin")
+	}
+}
+
+type svgDocument struct {
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+	Groups []struct {
+		Z     string `xml:"data-z,attr"`
+		Paths []struct {
+			D        string `xml:"d,attr"`
+			FillRule string `xml:"fill-rule,attr"`
+		} `xml:"path"`
+	} `xml:"g"`
+}
+
+func readSVG(t *testing.T, path string) *svgDocument {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	doc := new(svgDocument)
+	if err = xml.NewDecoder(file).Decode(doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestExportSVG(t *testing.T) {
+	// A box in the cavity is an island inside the hole
+	abuf := append(hollowBox(10, 2), boxMesh(vec3.T{4, 4, 4}, vec3.T{6, 6, 6})...)
+
+	path := "/tmp/section.svg"
+	if err := ExportSVG(abuf, path, 5, FillEvenOdd); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := readSVG(t, path)
+	if doc.Width != "10mm" || doc.Height != "10mm" || len(doc.Groups) != 1 {
+		t.Fatalf("Wrong document %+v", doc)
+	}
+	paths := doc.Groups[0].Paths
+	if len(paths) != 2 {
+		t.Fatalf("Expected 2 paths, got %d", len(paths))
+	}
+	if strings.Count(paths[0].D, "M") != 2 || strings.Count(paths[1].D, "M") != 1 {
+		t.Fatalf("Holes not nested into their paths: %v", paths)
+	}
+	if paths[0].FillRule != "evenodd" {
+		t.Fatalf("Wrong fill rule %s", paths[0].FillRule)
+	}
+	if !strings.HasPrefix(paths[1].D, "M") || !strings.Contains(paths[1].D, "4,4") || !strings.Contains(paths[1].D, "6,6") {
+		t.Fatalf("Island in the wrong place: %s", paths[1].D)
+	}
+
+	// Bad input leaves no file behind
+	path = "/tmp/badrule.svg"
+	os.Remove(path)
+	if err := ExportSVG(abuf, path, 5, FillWinding); err != ErrFillRule {
+		t.Fatalf("Expected ErrFillRule, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Failed export left %s behind", path)
+	}
+	if err := WriteSVG(io.Discard, []*Section{nil}, [2]vec2.T{}, FillEvenOdd); err != ErrNilSection {
+		t.Fatalf("Expected ErrNilSection, got %v", err)
+	}
+}
+
+func TestExportSVGLayers(t *testing.T) {
+	abuf := hollowBox(10, 2)
+
+	if err := ExportSVGLayers(abuf, "/tmp/layers.svg", 2, FillNonZero, false); err != nil {
+		t.Fatal(err)
+	}
+	doc := readSVG(t, "/tmp/layers.svg")
+	if len(doc.Groups) != 5 || doc.Groups[0].Z != "1" || doc.Groups[4].Z != "9" {
+		t.Fatalf("Wrong layers %+v", doc.Groups)
+	}
+	if strings.Count(doc.Groups[0].Paths[0].D, "M") != 1 || strings.Count(doc.Groups[2].Paths[0].D, "M") != 2 {
+		t.Fatal("Wrong contours in layers")
+	}
+
+	dir := "/tmp/svglayers"
+	os.RemoveAll(dir)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportSVGLayers(abuf, dir+"/layer.svg", 2, FillNonZero, true); err != ErrLayerPath {
+		t.Fatalf("Expected ErrLayerPath, got %v", err)
+	}
+	if err := ExportSVGLayers(abuf, dir+"/layer%d.svg", 2, FillNonZero, true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		doc := readSVG(t, fmt.Sprintf("%s/layer%d.svg", dir, i))
+		if len(doc.Groups) != 1 || doc.Width != "10mm" {
+			t.Fatalf("Wrong layer file %d: %+v", i, doc)
+		}
+	}
+}
+
+// dxfGroup is one code/value pair of a DXF file.
+type dxfGroup struct {
+	code  int
+	value string
+}
+
+// dxfEntity is a run of groups starting at a code 0 group.
+type dxfEntity struct {
+	kind   string
+	groups []dxfGroup
+}
+
+// all returns the values of every group with the given code.
+func (this *dxfEntity) all(code int) []string {
+	var values []string
+	for _, group := range this.groups {
+		if group.code == code {
+			values = append(values, group.value)
+		}
+	}
+	return values
+}
+
+// get returns the value of the first group with the given code.
+func (this *dxfEntity) get(code int) (string, bool) {
+	values := this.all(code)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+func (this *dxfEntity) floats(t *testing.T, code int) []float64 {
+	var result []float64
+	for _, value := range this.all(code) {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("%s group %d: %v", this.kind, code, err)
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// handle returns the handle of the entity, which dimension styles keep in
+// group 105.
+func (this *dxfEntity) handle() string {
+	if this.kind == "DIMSTYLE" {
+		handle, _ := this.get(105)
+		return handle
+	}
+	handle, _ := this.get(5)
+	return handle
+}
+
+// hasSubclass reports whether the entity has the given subclass marker.
+func (this *dxfEntity) hasSubclass(name string) bool {
+	for _, marker := range this.all(100) {
+		if marker == name {
+			return true
+		}
+	}
+	return false
+}
+
+// dxfPolyline is an LWPOLYLINE at its elevation.
+type dxfPolyline struct {
+	layer    string
+	closed   bool
+	vertices []vec3.T
+}
+
+// dxfFile is the structure of an R2000 DXF file.
+type dxfFile struct {
+	header    map[string]string
+	tables    map[string][]dxfEntity
+	blocks    []string
+	polylines []dxfPolyline
+}
+
+// readDXF parses a DXF file into its sections, failing on anything that
+// doesn't nest the way R2000 requires or refers to a missing handle.
+func readDXF(t *testing.T, path string) *dxfFile {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines)%2 != 0 {
+		t.Fatalf("%s has an odd number of lines", path)
+	}
+	var entities []dxfEntity
+	for i := 0; i < len(lines); i += 2 {
+		code, err := strconv.Atoi(strings.TrimSpace(lines[i]))
+		if err != nil {
+			t.Fatalf("Line %d: bad group code %q", i+1, lines[i])
+		}
+		group := dxfGroup{code, lines[i+1]}
+		switch {
+		case code == 0:
+			entities = append(entities, dxfEntity{kind: group.value})
+		case len(entities) == 0:
+			t.Fatalf("Group %d before the first entity", code)
+		default:
+			last := &entities[len(entities)-1]
+			last.groups = append(last.groups, group)
+		}
+	}
+	if len(entities) == 0 || entities[len(entities)-1].kind != "EOF" {
+		t.Fatalf("%s doesn't end with EOF", path)
+	}
+	entities = entities[:len(entities)-1]
+
+	file := &dxfFile{header: make(map[string]string), tables: make(map[string][]dxfEntity)}
+	file.checkHandles(t, entities)
+
+	var sections []string
+	for len(entities) > 0 {
+		name, _ := entities[0].get(2)
+		if entities[0].kind != "SECTION" {
+			t.Fatalf("Expected SECTION, got %s", entities[0].kind)
+		}
+		sections = append(sections, name)
+		end := 1
+		for end < len(entities) && entities[end].kind != "ENDSEC" {
+			end++
+		}
+		if end == len(entities) {
+			t.Fatalf("Section %s has no ENDSEC", name)
+		}
+
+		body := entities[0].groups[1:]
+		switch name {
+		case "HEADER":
+			if len(body)%2 != 0 || end != 1 {
+				t.Fatalf("Malformed HEADER")
+			}
+			for i := 0; i < len(body); i += 2 {
+				if body[i].code != 9 {
+					t.Fatalf("Header variable with code %d", body[i].code)
+				}
+				file.header[body[i].value] = body[i+1].value
+			}
+		case "TABLES":
+			file.readTables(t, entities[1:end])
+		case "BLOCKS":
+			file.readBlocks(t, entities[1:end])
+		case "ENTITIES":
+			file.readEntities(t, entities[1:end])
+		case "OBJECTS":
+			if end == 1 || entities[1].kind != "DICTIONARY" {
+				t.Fatalf("OBJECTS doesn't start with the root dictionary")
+			}
+		default:
+			t.Fatalf("Unexpected section %s", name)
+		}
+		entities = entities[end+1:]
+	}
+	if strings.Join(sections, " ") != "HEADER TABLES BLOCKS ENTITIES OBJECTS" {
+		t.Fatalf("Wrong sections %v", sections)
+	}
+	return file
+}
+
+// checkHandles checks that every object outside the header has a unique
+// handle below $HANDSEED, and that owners refer to one of them.
+func (this *dxfFile) checkHandles(t *testing.T, entities []dxfEntity) {
+	seed, ok := entities[0].get(5)
+	if !ok {
+		t.Fatal("No $HANDSEED")
+	}
+	limit, err := strconv.ParseUint(seed, 16, 64)
+	if err != nil {
+		t.Fatalf("Bad $HANDSEED %q", seed)
+	}
+
+	handles := map[string]bool{"0": true}
+	for i := range entities {
+		switch entities[i].kind {
+		case "SECTION", "ENDSEC", "ENDTAB":
+			continue
+		}
+		handle := entities[i].handle()
+		value, err := strconv.ParseUint(handle, 16, 64)
+		if err != nil || value == 0 || value >= limit || handles[handle] {
+			t.Fatalf("%s has bad handle %q", entities[i].kind, handle)
+		}
+		handles[handle] = true
+	}
+	for i := range entities {
+		for _, owner := range entities[i].all(330) {
+			if !handles[owner] {
+				t.Fatalf("%s owned by missing handle %q", entities[i].kind, owner)
+			}
+		}
+	}
+}
+
+func (this *dxfFile) readTables(t *testing.T, entities []dxfEntity) {
+	for len(entities) > 0 {
+		table := entities[0]
+		name, _ := table.get(2)
+		if table.kind != "TABLE" || !table.hasSubclass("AcDbSymbolTable") {
+			t.Fatalf("Expected a symbol TABLE, got %s", table.kind)
+		}
+		end := 1
+		for end < len(entities) && entities[end].kind != "ENDTAB" {
+			record := &entities[end]
+			if record.kind != name || !record.hasSubclass("AcDbSymbolTableRecord") {
+				t.Fatalf("%s entry in %s table", record.kind, name)
+			}
+			if owner, _ := record.get(330); owner != table.handle() {
+				t.Fatalf("%s record owned by %s, not its table", name, owner)
+			}
+			end++
+		}
+		if end == len(entities) {
+			t.Fatalf("Table %s has no ENDTAB", name)
+		}
+		if count, _ := table.get(70); count != fmt.Sprint(end-1) {
+			t.Fatalf("Table %s claims %s entries, has %d", name, count, end-1)
+		}
+		this.tables[name] = entities[1:end]
+		entities = entities[end+1:]
+	}
+}
+
+func (this *dxfFile) readBlocks(t *testing.T, entities []dxfEntity) {
+	for len(entities) > 0 {
+		if len(entities) < 2 || entities[0].kind != "BLOCK" || entities[1].kind != "ENDBLK" {
+			t.Fatalf("Expected an empty BLOCK, got %s", entities[0].kind)
+		}
+		if !entities[0].hasSubclass("AcDbBlockBegin") || !entities[1].hasSubclass("AcDbBlockEnd") {
+			t.Fatal("Block without subclass markers")
+		}
+		name, _ := entities[0].get(2)
+		this.blocks = append(this.blocks, name)
+		entities = entities[2:]
+	}
+}
+
+func (this *dxfFile) readEntities(t *testing.T, entities []dxfEntity) {
+	for i := range entities {
+		polyline := &entities[i]
+		if polyline.kind != "LWPOLYLINE" {
+			t.Fatalf("Unexpected entity %s", polyline.kind)
+		}
+		if !polyline.hasSubclass("AcDbEntity") || !polyline.hasSubclass("AcDbPolyline") {
+			t.Fatal("LWPOLYLINE without subclass markers")
+		}
+
+		layer, _ := polyline.get(8)
+		flags, _ := polyline.get(70)
+		count, _ := polyline.get(90)
+		xs, ys, zs := polyline.floats(t, 10), polyline.floats(t, 20), polyline.floats(t, 38)
+		if count != fmt.Sprint(len(xs)) || len(ys) != len(xs) || len(zs) != 1 {
+			t.Fatalf("LWPOLYLINE claims %s vertices, has %d x, %d y and %d elevations",
+				count, len(xs), len(ys), len(zs))
+		}
+
+		result := dxfPolyline{layer: layer, closed: flags == "1"}
+		for j := range xs {
+			result.vertices = append(result.vertices, vec3.T{xs[j], ys[j], zs[0]})
+		}
+		this.polylines = append(this.polylines, result)
+	}
+}
+
+// checkReferences checks that every layer and linetype used is defined.
+func (this *dxfFile) checkReferences(t *testing.T) {
+	linetypes := make(map[string]bool)
+	for _, linetype := range this.tables["LTYPE"] {
+		name, _ := linetype.get(2)
+		linetypes[name] = true
+	}
+	layers := make(map[string]bool)
+	for _, layer := range this.tables["LAYER"] {
+		name, _ := layer.get(2)
+		linetype, _ := layer.get(6)
+		if !linetypes[linetype] {
+			t.Fatalf("Layer %s uses undefined linetype %q", name, linetype)
+		}
+		layers[name] = true
+	}
+	for _, polyline := range this.polylines {
+		if !layers[polyline.layer] {
+			t.Fatalf("Polyline on undefined layer %q", polyline.layer)
+		}
+	}
+}
+
+func TestExportDXF(t *testing.T) {
+	path := "/tmp/section.dxf"
+	if err := ExportDXF(hollowBox(10, 2), path, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	file := readDXF(t, path)
+	if file.header["$ACADVER"] != "AC1015" || file.header["$INSUNITS"] != "4" {
+		t.Fatalf("Wrong version or units in header %v", file.header)
+	}
+	if strings.Join(file.blocks, " ") != "*Model_Space *Paper_Space" {
+		t.Fatalf("Wrong blocks %v", file.blocks)
+	}
+	file.checkReferences(t)
+	if len(file.polylines) != 2 {
+		t.Fatalf("Expected 2 polylines, got %d", len(file.polylines))
+	}
+	for _, polyline := range file.polylines {
+		if !polyline.closed || len(polyline.vertices) != 8 || polyline.layer != "SLICE0" {
+			t.Fatalf("Wrong polyline %+v", polyline)
+		}
+		for _, vertex := range polyline.vertices {
+			if vertex[2] != 5 || vertex[0] < 0 || vertex[0] > 10 || vertex[1] < 0 || vertex[1] > 10 {
+				t.Fatalf("Vertex %v out of the section", vertex)
+			}
+		}
+	}
+
+	path = "/tmp/layers.dxf"
+	if err := ExportDXFLayers(hollowBox(10, 2), path, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	file = readDXF(t, path)
+	file.checkReferences(t)
+	if len(file.tables["LAYER"]) != 6 {
+		t.Fatalf("Expected layer 0 and 5 slice layers, got %d", len(file.tables["LAYER"]))
+	}
+	layers := make(map[string]int)
+	for _, polyline := range file.polylines {
+		layers[polyline.layer]++
+	}
+	if len(layers) != 5 || layers["SLICE0"] != 1 || layers["SLICE2"] != 2 {
+		t.Fatalf("Wrong polylines per layer %v", layers)
+	}
+}
+
+// pyramid returns the sloped sides of a square pyramid.
+func pyramid(size, height float64) mesh.ArrayBuffer {
+	corners := []vec3.T{{0, 0, 0}, {size, 0, 0}, {size, size, 0}, {0, size, 0}}
+	apex := vec3.T{size / 2, size / 2, height}
+
+	abuf := make(mesh.ArrayBuffer, 0, 4)
+	for i := range corners {
+		abuf = append(abuf, mesh.Triangle{corners[i], corners[(i+1)%4], apex})
+	}
+	return abuf
+}
+
+func TestAdaptiveLayers(t *testing.T) {
+	// Vertical walls below z = 0 and a shallow roof above
+	abuf := append(boxMesh(vec3.T{0, 0, -4}, vec3.T{20, 20, 0}), pyramid(20, 2)...)
+	minHeight, maxHeight, maxCusp := 0.02, 0.3, 0.05
+
+	schedule, err := AdaptiveLayers(abuf, minHeight, maxHeight, maxCusp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tops := schedule.Tops()
+	if schedule.Bottom != -4 || math.Abs(tops[len(tops)-1]-2) > 1e-9 {
+		t.Fatalf("Layers run from %v to %v", schedule.Bottom, tops[len(tops)-1])
+	}
+	if schedule.Heights[0] != maxHeight {
+		t.Fatalf("Walls should get the thickest layers, got %v", schedule.Heights[0])
+	}
+
+	// The roof rises 1 in 5
+	nz := 5 / math.Sqrt(26)
+	for i, height := range schedule.Heights {
+		if height > maxHeight+1e-9 || height < minHeight-1e-9 {
+			t.Fatalf("Layer %d is %v thick", i, height)
+		}
+		if tops[i] > 1e-9 && height*nz > maxCusp+1e-9 {
+			t.Fatalf("Layer %d at %v leaves a %v cusp", i, tops[i], height*nz)
+		}
+	}
+
+	sections := SliceSchedule(abuf, schedule)
+	if len(sections) != schedule.Len() {
+		t.Fatalf("Expected %d sections, got %d", schedule.Len(), len(sections))
+	}
+
+	// Walls ending just above a whole number of layers, a roof so shallow its
+	// layers are all minHeight thick, and walls thinner than a layer all end
+	// without slivers
+	cases := []struct {
+		abuf   mesh.ArrayBuffer
+		height float64
+	}{
+		{boxMesh(vec3.T{0, 0, 0}, vec3.T{1, 1, 0.31}), 0.31},
+		{boxMesh(vec3.T{0, 0, 0}, vec3.T{1, 1, 0.61}), 0.61},
+		{pyramid(20, 2.03), 2.03},
+		{pyramid(20, 2.05), 2.05},
+		{boxMesh(vec3.T{0, 0, 0}, vec3.T{1, 1, 0.05}), 0.05},
+		{boxMesh(vec3.T{0, 0, 0}, vec3.T{1, 1, 0.01}), 0.01},
+	}
+	for _, c := range cases {
+		schedule, err := AdaptiveLayers(c.abuf, minHeight, maxHeight, 0.01)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var total float64
+		for i, height := range schedule.Heights {
+			total += height
+			if height > maxHeight+1e-9 || (height < minHeight-1e-9 && c.height >= minHeight) {
+				t.Fatalf("Layer %d of %v is %v thick", i, c.height, height)
+			}
+		}
+		if math.Abs(total-c.height) > 1e-9 {
+			t.Fatalf("Layers of %v add up to %v", c.height, total)
+		}
+	}
+
+	if _, err := AdaptiveLayers(abuf, 0.3, 0.1, maxCusp); err != ErrLayerBounds {
+		t.Fatalf("Expected ErrLayerBounds, got %v", err)
+	}
+
+	uniform := UniformLayers(abuf, 0.5)
+	if uniform.Len() != 12 || uniform.Middles()[0] != -3.75 {
+		t.Fatalf("Wrong uniform layers %+v", uniform)
+	}
+}
@@ -0,0 +1,47 @@
+package svx
+
+import (
+	"sort"
+
+	. "github.com/alexozer/go-mesh"
+)
+
+// zSweep hands out, for increasing z, the triangles that cross the plane at
+// z. Each triangle enters and leaves the active set once, so a full sweep
+// costs O(triangles log triangles) plus the size of the active sets instead
+// of O(layers × triangles).
+type zSweep struct {
+	pending []BoxedTriangle // Sorted by lower z bound
+	active  []BoxedTriangle
+}
+
+func newZSweep(boxedTris []BoxedTriangle) *zSweep {
+	pending := make([]BoxedTriangle, len(boxedTris))
+	copy(pending, boxedTris)
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].LowerBound[2] < pending[j].LowerBound[2]
+	})
+
+	return &zSweep{pending: pending, active: make([]BoxedTriangle, 0)}
+}
+
+// advance moves the sweep up to the slab from low to high and returns the
+// triangles crossing any plane in it. The returned slice is only valid until
+// the next call. Neither bound may decrease between calls.
+func (this *zSweep) advance(low, high float64) []BoxedTriangle {
+	for len(this.pending) > 0 && this.pending[0].LowerBound[2] < high {
+		this.active = append(this.active, this.pending[0])
+		this.pending = this.pending[1:]
+	}
+
+	// Vertices on a plane count as above it, matching zPlane.intersectsLine
+	kept := this.active[:0]
+	for _, tri := range this.active {
+		if tri.UpperBound[2] >= low {
+			kept = append(kept, tri)
+		}
+	}
+	this.active = kept
+
+	return this.active
+}
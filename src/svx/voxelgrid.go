@@ -0,0 +1,238 @@
+package svx
+
+import (
+	"errors"
+	"image"
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+var ErrGridMismatch = errors.New("Voxel grids have different voxel sizes or are misaligned")
+
+// VoxelGrid is a dense grid of voxel densities, from 0 (empty) to 255 (solid).
+// Voxel (x, y, z) covers the cube whose lower corner is
+// Origin + (x, y, z)·VoxelSize. Like meshes, the grid is measured in mm.
+type VoxelGrid struct {
+	SizeX, SizeY, SizeZ int
+	VoxelSize           float64
+	Origin              vec3.T
+	Density             []uint8 // Indexed by x + SizeX*(y + SizeY*z)
+}
+
+func NewVoxelGrid(sizeX, sizeY, sizeZ int, voxelSize float64, origin vec3.T) *VoxelGrid {
+	return &VoxelGrid{
+		SizeX:     sizeX,
+		SizeY:     sizeY,
+		SizeZ:     sizeZ,
+		VoxelSize: voxelSize,
+		Origin:    origin,
+		Density:   make([]uint8, sizeX*sizeY*sizeZ),
+	}
+}
+
+func (this *VoxelGrid) InBounds(x, y, z int) bool {
+	return x >= 0 && x < this.SizeX &&
+		y >= 0 && y < this.SizeY &&
+		z >= 0 && z < this.SizeZ
+}
+
+func (this *VoxelGrid) index(x, y, z int) int {
+	return x + this.SizeX*(y+this.SizeY*z)
+}
+
+// At returns the density of a voxel. Voxels outside the grid are empty.
+func (this *VoxelGrid) At(x, y, z int) uint8 {
+	if !this.InBounds(x, y, z) {
+		return 0
+	}
+	return this.Density[this.index(x, y, z)]
+}
+
+// Set changes the density of a voxel. Voxels outside the grid are ignored.
+func (this *VoxelGrid) Set(x, y, z int, density uint8) {
+	if this.InBounds(x, y, z) {
+		this.Density[this.index(x, y, z)] = density
+	}
+}
+
+// Center returns the center of a voxel in model coordinates.
+func (this *VoxelGrid) Center(x, y, z int) vec3.T {
+	return vec3.T{
+		this.Origin[0] + (float64(x)+0.5)*this.VoxelSize,
+		this.Origin[1] + (float64(y)+0.5)*this.VoxelSize,
+		this.Origin[2] + (float64(z)+0.5)*this.VoxelSize,
+	}
+}
+
+func (this *VoxelGrid) Copy() *VoxelGrid {
+	result := *this
+	result.Density = make([]uint8, len(this.Density))
+	copy(result.Density, this.Density)
+	return &result
+}
+
+// Export writes the grid to an .svx file.
+func (this *VoxelGrid) Export(path string, author string) error {
+	return buildArchive(path, func(buildDir string) (*manifest, error) {
+		for z := 0; z < this.SizeZ; z++ {
+			if err := writeSlice(buildDir, &defaultChannel, z, this.sliceImage(z)); err != nil {
+				return nil, err
+			}
+		}
+
+		// The manifest measures voxels in m rather than mm
+		manifest := newManifest(author, this.SizeX, this.SizeY, this.SizeZ,
+			float32(this.VoxelSize*mmSize))
+		manifest.setOrigin(this.Origin)
+		return manifest, nil
+	})
+}
+
+func (this *VoxelGrid) sliceImage(z int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, this.SizeX, this.SizeY))
+	for y := 0; y < this.SizeY; y++ {
+		// Image rows run top to bottom, but grid y runs bottom to top
+		row := img.Pix[(this.SizeY-1-y)*img.Stride:]
+		copy(row[:this.SizeX], this.Density[this.index(0, y, z):])
+	}
+	return img
+}
+
+// setLayer copies a rasterized layer into the grid at height z.
+func (this *VoxelGrid) setLayer(z int, layer *layer) {
+	rect := layer.Img.Rect
+	for y := 0; y < this.SizeY; y++ {
+		for x := 0; x < this.SizeX; x++ {
+			// Image rows run top to bottom, but grid y runs bottom to top
+			this.Set(x, y, z, layer.Img.GrayAt(rect.Min.X+x, rect.Max.Y-1-y).Y)
+		}
+	}
+}
+
+// Union returns a grid covering both grids in which each voxel has the
+// higher of the two densities.
+func (this *VoxelGrid) Union(other *VoxelGrid) (*VoxelGrid, error) {
+	offset, err := this.offsetOf(other)
+	if err != nil {
+		return nil, err
+	}
+
+	var lower, upper [3]int
+	sizes := [3]int{this.SizeX, this.SizeY, this.SizeZ}
+	otherSizes := [3]int{other.SizeX, other.SizeY, other.SizeZ}
+	for i := range lower {
+		lower[i] = minInt(0, offset[i])
+		upper[i] = maxInt(sizes[i], offset[i]+otherSizes[i])
+	}
+
+	result := this.resized(lower, upper)
+	return result, result.combine(other, func(a, b uint8) uint8 {
+		if b > a {
+			return b
+		}
+		return a
+	})
+}
+
+// Intersection returns a grid the size of this one in which each voxel has
+// the lower of the two densities.
+func (this *VoxelGrid) Intersection(other *VoxelGrid) (*VoxelGrid, error) {
+	result := this.Copy()
+	return result, result.combine(other, func(a, b uint8) uint8 {
+		if b < a {
+			return b
+		}
+		return a
+	})
+}
+
+// Difference returns a grid the size of this one with the other grid's
+// material removed.
+func (this *VoxelGrid) Difference(other *VoxelGrid) (*VoxelGrid, error) {
+	result := this.Copy()
+	return result, result.combine(other, func(a, b uint8) uint8 {
+		if 255-b < a {
+			return 255 - b
+		}
+		return a
+	})
+}
+
+// combine replaces every voxel of this grid with op(this voxel, other voxel),
+// treating voxels outside the other grid as empty.
+func (this *VoxelGrid) combine(other *VoxelGrid, op func(a, b uint8) uint8) error {
+	offset, err := this.offsetOf(other)
+	if err != nil {
+		return err
+	}
+
+	for z := 0; z < this.SizeZ; z++ {
+		for y := 0; y < this.SizeY; y++ {
+			for x := 0; x < this.SizeX; x++ {
+				i := this.index(x, y, z)
+				this.Density[i] = op(this.Density[i], other.At(x-offset[0], y-offset[1], z-offset[2]))
+			}
+		}
+	}
+
+	return nil
+}
+
+// gridTolerance is how far, in voxels, two grids may be misaligned and still
+// be combined.
+const gridTolerance = 1e-6
+
+// offsetOf returns the position of the other grid's voxel (0, 0, 0) in this
+// grid's voxel coordinates.
+func (this *VoxelGrid) offsetOf(other *VoxelGrid) (offset [3]int, err error) {
+	if math.Abs(this.VoxelSize-other.VoxelSize) > gridTolerance*this.VoxelSize {
+		return offset, ErrGridMismatch
+	}
+
+	for i := range offset {
+		steps := (other.Origin[i] - this.Origin[i]) / this.VoxelSize
+		rounded := math.Floor(steps + 0.5)
+		if math.Abs(steps-rounded) > gridTolerance {
+			return offset, ErrGridMismatch
+		}
+		offset[i] = int(rounded)
+	}
+
+	return offset, nil
+}
+
+// resized returns a copy of the grid covering voxels lower up to but not
+// including upper, in this grid's voxel coordinates. New voxels are empty.
+func (this *VoxelGrid) resized(lower, upper [3]int) *VoxelGrid {
+	origin := this.Origin
+	for i := range origin {
+		origin[i] += float64(lower[i]) * this.VoxelSize
+	}
+
+	result := NewVoxelGrid(upper[0]-lower[0], upper[1]-lower[1], upper[2]-lower[2],
+		this.VoxelSize, origin)
+	for z := 0; z < result.SizeZ; z++ {
+		for y := 0; y < result.SizeY; y++ {
+			for x := 0; x < result.SizeX; x++ {
+				result.Density[result.index(x, y, z)] = this.At(x+lower[0], y+lower[1], z+lower[2])
+			}
+		}
+	}
+
+	return result
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,135 @@
+package mesh
+
+import (
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// Transform is an affine map, taking pt to Linear·pt + Translation.
+type Transform struct {
+	Linear      [3][3]float64
+	Translation vec3.T
+}
+
+func IdentityTransform() Transform {
+	return Transform{Linear: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}}
+}
+
+func Translation(offset vec3.T) Transform {
+	result := IdentityTransform()
+	result.Translation = offset
+	return result
+}
+
+// Rotation turns counter-clockwise by angle radians about axis, looking down
+// the axis towards the origin.
+func Rotation(axis vec3.T, angle float64) Transform {
+	axis = axis.Normalized()
+	c, s := math.Cos(angle), math.Sin(angle)
+	x, y, z := axis[0], axis[1], axis[2]
+
+	// Rodrigues' rotation formula
+	return Transform{Linear: [3][3]float64{
+		{c + x*x*(1-c), x*y*(1-c) - z*s, x*z*(1-c) + y*s},
+		{y*x*(1-c) + z*s, c + y*y*(1-c), y*z*(1-c) - x*s},
+		{z*x*(1-c) - y*s, z*y*(1-c) + x*s, c + z*z*(1-c)},
+	}}
+}
+
+// RotationBetween returns the shortest rotation turning the direction from
+// onto the direction to.
+func RotationBetween(from, to vec3.T) Transform {
+	from, to = from.Normalized(), to.Normalized()
+	axis := vec3.Cross(&from, &to)
+	cos := vec3.Dot(&from, &to)
+	if axis.Length() > epsilon {
+		return Rotation(axis, math.Atan2(axis.Length(), cos))
+	}
+	if cos > 0 {
+		return IdentityTransform()
+	}
+
+	// Half a turn about any axis square to from
+	helper := vec3.UnitX
+	if math.Abs(from[0]) > 0.9 {
+		helper = vec3.UnitY
+	}
+	axis = vec3.Cross(&from, &helper)
+	return Rotation(axis, math.Pi)
+}
+
+func (this *Transform) Apply(pt vec3.T) vec3.T {
+	result := this.ApplyVector(pt)
+	return vec3.Add(&result, &this.Translation)
+}
+
+// ApplyVector transforms a direction, leaving out the translation.
+func (this *Transform) ApplyVector(v vec3.T) vec3.T {
+	var result vec3.T
+	for i, row := range this.Linear {
+		result[i] = row[0]*v[0] + row[1]*v[1] + row[2]*v[2]
+	}
+	return result
+}
+
+// Then returns the transform applying this one and then next.
+func (this *Transform) Then(next *Transform) Transform {
+	var result Transform
+	for i := range result.Linear {
+		for j := range result.Linear[i] {
+			for k := 0; k < 3; k++ {
+				result.Linear[i][j] += next.Linear[i][k] * this.Linear[k][j]
+			}
+		}
+	}
+	result.Translation = next.Apply(this.Translation)
+	return result
+}
+
+// Inverse returns the transform undoing this one, which must not be singular.
+func (this *Transform) Inverse() Transform {
+	m := &this.Linear
+	var result Transform
+
+	// Adjugate over determinant
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			result.Linear[i][j] = m[a][c]*m[b][d] - m[a][d]*m[b][c]
+		}
+	}
+	det := m[0][0]*result.Linear[0][0] + m[0][1]*result.Linear[1][0] + m[0][2]*result.Linear[2][0]
+	for i := range result.Linear {
+		for j := range result.Linear[i] {
+			result.Linear[i][j] /= det
+		}
+	}
+
+	result.Translation = result.ApplyVector(this.Translation)
+	result.Translation.Invert()
+	return result
+}
+
+// ApplyMesh returns a transformed copy of the mesh. Transforms that mirror
+// also flip the triangles, so that they keep facing outwards.
+func (this *Transform) ApplyMesh(mesh Mesh) ArrayBuffer {
+	abuf := ArrayBuffer{}
+	abuf.ConvertFrom(mesh)
+	result := abuf.transform(this.Apply)
+
+	if this.determinant() < 0 {
+		for i := range result {
+			result[i][1], result[i][2] = result[i][2], result[i][1]
+		}
+	}
+	return result
+}
+
+func (this *Transform) determinant() float64 {
+	m := &this.Linear
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}